@@ -3,6 +3,7 @@ package auth
 import (
 	"bytes"
 	"errors"
+	"log/slog"
 	"strings"
 	"unsafe"
 
@@ -44,6 +45,19 @@ func (a *Authorization) Username() string     { return a.username }
 func (a *Authorization) HeaderValue() string  { return a.headerValue }
 func (a *Authorization) HasSecretBytes() bool { return a.secretBytes != nil }
 func (a *Authorization) SecretBytes() []byte  { return a.secretBytes }
+
+// LogValue keeps the secret out of logs, by only logging
+// the type and username.
+func (a *Authorization) LogValue() slog.Value {
+	if a == nil {
+		return slog.Value{}
+	}
+	return slog.GroupValue(
+		slog.String("type", a.authType.String()),
+		slog.String("username", a.username),
+	)
+}
+
 func (a *Authorization) PasswordLength() int {
 	switch a.authType {
 	case BasicAuthType:
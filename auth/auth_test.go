@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"bytes"
+	"log/slog"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -194,3 +196,14 @@ func joinBytes(a []byte, rest ...[]byte) []byte {
 	}
 	return out
 }
+
+func TestLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	auth := NewBasicAuth("someone", "secret")
+	logger.Info("connect", "auth", auth)
+
+	assert.Contains(t, buf.String(), "auth.type=Basic auth.username=someone")
+	assert.NotContains(t, buf.String(), "secret")
+	assert.NotContains(t, buf.String(), auth.HeaderValue())
+}
@@ -0,0 +1,200 @@
+// Package bindvars builds vitess BindVariables from native Go values.
+package bindvars
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+)
+
+const datetimeLayout = "2006-01-02 15:04:05.999999"
+
+var ErrNestedTuple = errors.New("tuples cannot be nested")
+
+// Value converts v into a BindVariable.
+//
+//	nil, nil pointers                NULL
+//	signed integers                  INT64
+//	unsigned integers                UINT64
+//	float32, float64                 FLOAT64
+//	bool                             INT64, 1 or 0
+//	string                           VARCHAR
+//	[]byte                           VARBINARY
+//	json.RawMessage                  JSON
+//	time.Time                        DATETIME, in UTC
+//	driver.Valuer                    the converted result of Value()
+//	any other slice or array         TUPLE, for use with IN (...)
+//
+// Pointers are dereferenced, named types are converted by their
+// underlying kind, and a *querypb.BindVariable is returned unchanged.
+func Value(v any) (*querypb.BindVariable, error) {
+	bv, err := value(v)
+	if err != nil {
+		return nil, err
+	}
+	if bv != nil {
+		return bv, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return &querypb.BindVariable{Type: querypb.Type_NULL_TYPE}, nil
+		}
+		return Value(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Uint64(rv.Uint()), nil
+	case reflect.Float32:
+		return float32Value(float32(rv.Float())), nil
+	case reflect.Float64:
+		return Float64(rv.Float()), nil
+	case reflect.Bool:
+		return value(rv.Bool())
+	case reflect.String:
+		return String(rv.String()), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return Bytes(rv.Bytes()), nil
+		}
+		return tuple(rv)
+	case reflect.Array:
+		return tuple(rv)
+	}
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+// value converts the scalar types, returning nil when v isn't one of them.
+func value(v any) (*querypb.BindVariable, error) {
+	switch v := v.(type) {
+	case nil:
+		return &querypb.BindVariable{Type: querypb.Type_NULL_TYPE}, nil
+	case *querypb.BindVariable:
+		return v, nil
+	case int:
+		return Int64(int64(v)), nil
+	case int8:
+		return Int64(int64(v)), nil
+	case int16:
+		return Int64(int64(v)), nil
+	case int32:
+		return Int64(int64(v)), nil
+	case int64:
+		return Int64(v), nil
+	case uint:
+		return Uint64(uint64(v)), nil
+	case uint8:
+		return Uint64(uint64(v)), nil
+	case uint16:
+		return Uint64(uint64(v)), nil
+	case uint32:
+		return Uint64(uint64(v)), nil
+	case uint64:
+		return Uint64(v), nil
+	case float32:
+		return float32Value(v), nil
+	case float64:
+		return Float64(v), nil
+	case bool:
+		if v {
+			return Int64(1), nil
+		}
+		return Int64(0), nil
+	case string:
+		return String(v), nil
+	case json.RawMessage:
+		return &querypb.BindVariable{Type: querypb.Type_JSON, Value: v}, nil
+	case []byte:
+		return Bytes(v), nil
+	case time.Time:
+		return Time(v), nil
+	case driver.Valuer:
+		// a nil pointer implementing Valuer with a value receiver
+		// would panic, treat it as NULL like database/sql does
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return &querypb.BindVariable{Type: querypb.Type_NULL_TYPE}, nil
+		}
+		dv, err := v.Value()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := dv.(driver.Valuer); ok {
+			return nil, fmt.Errorf("driver.Valuer %T returned another driver.Valuer", v)
+		}
+		return Value(dv)
+	}
+	return nil, nil
+}
+
+func tuple(rv reflect.Value) (*querypb.BindVariable, error) {
+	values := make([]*querypb.Value, rv.Len())
+	for i := range values {
+		bv, err := Value(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if bv.Type == querypb.Type_TUPLE {
+			return nil, ErrNestedTuple
+		}
+		values[i] = &querypb.Value{Type: bv.Type, Value: bv.Value}
+	}
+	return &querypb.BindVariable{Type: querypb.Type_TUPLE, Values: values}, nil
+}
+
+func Int64(v int64) *querypb.BindVariable {
+	return &querypb.BindVariable{Type: querypb.Type_INT64, Value: strconv.AppendInt(nil, v, 10)}
+}
+
+func Uint64(v uint64) *querypb.BindVariable {
+	return &querypb.BindVariable{Type: querypb.Type_UINT64, Value: strconv.AppendUint(nil, v, 10)}
+}
+
+func Float64(v float64) *querypb.BindVariable {
+	return &querypb.BindVariable{Type: querypb.Type_FLOAT64, Value: strconv.AppendFloat(nil, v, 'g', -1, 64)}
+}
+
+// float32Value is a FLOAT64 formatted with the precision of v, so that
+// float32(0.1) is sent as 0.1 rather than 0.10000000149011612.
+func float32Value(v float32) *querypb.BindVariable {
+	return &querypb.BindVariable{Type: querypb.Type_FLOAT64, Value: strconv.AppendFloat(nil, float64(v), 'g', -1, 32)}
+}
+
+func String(v string) *querypb.BindVariable {
+	return &querypb.BindVariable{Type: querypb.Type_VARCHAR, Value: []byte(v)}
+}
+
+func Bytes(v []byte) *querypb.BindVariable {
+	return &querypb.BindVariable{Type: querypb.Type_VARBINARY, Value: v}
+}
+
+func Time(v time.Time) *querypb.BindVariable {
+	return &querypb.BindVariable{Type: querypb.Type_DATETIME, Value: v.UTC().AppendFormat(nil, datetimeLayout)}
+}
+
+// Map converts named values, keyed by bind variable name without
+// the leading colon.
+func Map(named map[string]any) (map[string]*querypb.BindVariable, error) {
+	bindVars := make(map[string]*querypb.BindVariable, len(named))
+	for name, v := range named {
+		bv, err := Value(v)
+		if err != nil {
+			return nil, fmt.Errorf("bind variable %s: %w", name, err)
+		}
+		bindVars[name] = bv
+	}
+	return bindVars, nil
+}
+
+// Name returns the name vitess gives to the i-th ? placeholder,
+// counting from 1.
+func Name(i int) string {
+	return "v" + strconv.Itoa(i)
+}
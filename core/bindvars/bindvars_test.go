@@ -0,0 +1,86 @@
+package bindvars
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	myInt     int
+	myFloat32 float32
+)
+
+func TestValue(t *testing.T) {
+	s := "ptr"
+	var nilPtr *string
+	cases := []struct {
+		in  any
+		out *querypb.BindVariable
+	}{
+		{nil, &querypb.BindVariable{Type: querypb.Type_NULL_TYPE}},
+		{nilPtr, &querypb.BindVariable{Type: querypb.Type_NULL_TYPE}},
+		{&s, &querypb.BindVariable{Type: querypb.Type_VARCHAR, Value: []byte("ptr")}},
+		{-1, &querypb.BindVariable{Type: querypb.Type_INT64, Value: []byte("-1")}},
+		{myInt(7), &querypb.BindVariable{Type: querypb.Type_INT64, Value: []byte("7")}},
+		{uint64(18446744073709551615), &querypb.BindVariable{Type: querypb.Type_UINT64, Value: []byte("18446744073709551615")}},
+		{1.5, &querypb.BindVariable{Type: querypb.Type_FLOAT64, Value: []byte("1.5")}},
+		{float32(0.1), &querypb.BindVariable{Type: querypb.Type_FLOAT64, Value: []byte("0.1")}},
+		{myFloat32(0.1), &querypb.BindVariable{Type: querypb.Type_FLOAT64, Value: []byte("0.1")}},
+		{true, &querypb.BindVariable{Type: querypb.Type_INT64, Value: []byte("1")}},
+		{"foo", &querypb.BindVariable{Type: querypb.Type_VARCHAR, Value: []byte("foo")}},
+		{[]byte{0, 1}, &querypb.BindVariable{Type: querypb.Type_VARBINARY, Value: []byte{0, 1}}},
+		{json.RawMessage(`{}`), &querypb.BindVariable{Type: querypb.Type_JSON, Value: []byte(`{}`)}},
+		{
+			time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.FixedZone("x", 3600)),
+			&querypb.BindVariable{Type: querypb.Type_DATETIME, Value: []byte("2024-01-02 02:04:05.6")},
+		},
+		{sql.NullInt64{}, &querypb.BindVariable{Type: querypb.Type_NULL_TYPE}},
+		{sql.NullInt64{Int64: 3, Valid: true}, &querypb.BindVariable{Type: querypb.Type_INT64, Value: []byte("3")}},
+		{[]any{1, "a", nil}, &querypb.BindVariable{Type: querypb.Type_TUPLE, Values: []*querypb.Value{
+			{Type: querypb.Type_INT64, Value: []byte("1")},
+			{Type: querypb.Type_VARCHAR, Value: []byte("a")},
+			{Type: querypb.Type_NULL_TYPE},
+		}}},
+	}
+	for _, c := range cases {
+		out, err := Value(c.in)
+		assert.Nil(t, err)
+		assert.Equal(t, c.out, out, "%#v", c.in)
+	}
+
+	_, err := Value([][]int{{1}})
+	assert.ErrorIs(t, err, ErrNestedTuple)
+	_, err = Value(struct{}{})
+	assert.Error(t, err)
+}
+
+func TestPositional(t *testing.T) {
+	cases := []struct {
+		in, out string
+		args    []any
+		err     bool
+	}{
+		{"select ?", "select :v1", []any{1}, false},
+		{"select * from t where a = ? and b in ?", "select * from t where a = :v1 and b in :v2", []any{1, []int{1, 2}}, false},
+		{`select '?', "?", ` + "`?`" + `, ?`, `select '?', "?", ` + "`?`" + `, :v1`, []any{1}, false},
+		{`select 'it''s ?', 'a\'?', ?`, `select 'it''s ?', 'a\'?', :v1`, []any{1}, false},
+		{"select ? -- ?\n, ? /* ? */ # ?", "select :v1 -- ?\n, :v2 /* ? */ # ?", []any{1, 2}, false},
+		{"select ?", "", nil, true},
+		{"select 1", "", []any{1}, true},
+	}
+	for _, c := range cases {
+		out, bindVars, err := Positional(c.in, c.args...)
+		if c.err {
+			assert.Error(t, err, c.in)
+			continue
+		}
+		assert.Nil(t, err, c.in)
+		assert.Equal(t, c.out, out)
+		assert.Len(t, bindVars, len(c.args))
+	}
+}
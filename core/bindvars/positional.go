@@ -0,0 +1,87 @@
+package bindvars
+
+import (
+	"fmt"
+	"strings"
+
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+)
+
+// Positional rewrites every ? placeholder in query to :v1, :v2, ...
+// and binds args to them in order. Placeholders inside quoted strings,
+// quoted identifiers and comments are left alone.
+func Positional(query string, args ...any) (string, map[string]*querypb.BindVariable, error) {
+	var (
+		b        strings.Builder
+		n        int
+		bindVars = make(map[string]*querypb.BindVariable, len(args))
+	)
+	b.Grow(len(query) + 2*len(args))
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := skipQuoted(query, i)
+			b.WriteString(query[i:end])
+			i = end - 1
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "-- ")):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+		case c == '?':
+			if n >= len(args) {
+				return "", nil, fmt.Errorf("query has more placeholders than the %d arguments given", len(args))
+			}
+			bv, err := Value(args[n])
+			if err != nil {
+				return "", nil, fmt.Errorf("argument %d: %w", n+1, err)
+			}
+			n++
+			name := Name(n)
+			bindVars[name] = bv
+			b.WriteByte(':')
+			b.WriteString(name)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if n != len(args) {
+		return "", nil, fmt.Errorf("query has %d placeholders, but %d arguments were given", n, len(args))
+	}
+	return b.String(), bindVars, nil
+}
+
+// skipQuoted returns the index just past the quoted string or identifier
+// starting at query[start]. Quotes are escaped by doubling them, and in
+// strings also by a backslash.
+func skipQuoted(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
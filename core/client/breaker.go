@@ -0,0 +1,261 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+//enumcheck:exhaustive
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every call straight away.
+	BreakerOpen
+	// BreakerHalfOpen lets a few probes through, to find out
+	// whether the address has recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerPolicy configures the circuit breaker of each address in a
+// ClientPool. Only CodeUnavailable, CodeDeadlineExceeded and errors from
+// the transport count as failures, errors returned by the database don't.
+// Calls cancelled by the caller count as neither.
+type BreakerPolicy struct {
+	// Failures is the number of consecutive failures that opens the breaker.
+	Failures int
+	// OpenDuration is how long the breaker stays open before
+	// letting probes through.
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of calls let through at once while
+	// half open. A successful probe closes the breaker, a failed one
+	// opens it again.
+	HalfOpenProbes int
+}
+
+func DefaultBreakerPolicy() *BreakerPolicy {
+	return &BreakerPolicy{
+		Failures:       5,
+		OpenDuration:   5 * time.Second,
+		HalfOpenProbes: 1,
+	}
+}
+
+// WithCircuitBreaker gives every address in a ClientPool a circuit breaker.
+// While it is open, calls to the address fail with CodeUnavailable and an
+// error matching ErrCircuitOpen, without touching the network.
+func WithCircuitBreaker(policy *BreakerPolicy) Option {
+	return func(c *config) {
+		c.breakerPolicy = policy
+	}
+}
+
+type circuitBreaker struct {
+	addr   string
+	policy *BreakerPolicy
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+func newCircuitBreaker(addr string, policy *BreakerPolicy) *circuitBreaker {
+	return &circuitBreaker{addr: addr, policy: policy}
+}
+
+func (b *circuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpenLocked(time.Now())
+	return b.state
+}
+
+// halfOpenLocked moves an open breaker to half open once
+// OpenDuration has passed.
+func (b *circuitBreaker) halfOpenLocked(now time.Time) {
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.policy.OpenDuration {
+		b.state = BreakerHalfOpen
+		b.probes = 0
+	}
+}
+
+// allow reports whether a call may go through, and whether it's a probe.
+func (b *circuitBreaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpenLocked(time.Now())
+	switch b.state {
+	case BreakerClosed:
+		return false, nil
+	case BreakerHalfOpen:
+		if b.probes < b.policy.HalfOpenProbes {
+			b.probes++
+			return true, nil
+		}
+	}
+	return false, connect.NewError(connect.CodeUnavailable, fmt.Errorf("%w: %s", ErrCircuitOpen, b.addr))
+}
+
+// record updates the breaker with the outcome of a call let through by allow.
+func (b *circuitBreaker) record(probe bool, err error) {
+	if err != nil && connect.CodeOf(err) == connect.CodeCanceled {
+		// the caller gave up, which says nothing about the address
+		b.release(probe)
+		return
+	}
+	failed := isBreakerFailure(err)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probes--
+		if b.state != BreakerHalfOpen {
+			return
+		}
+		if failed {
+			b.openLocked()
+		} else {
+			b.state, b.failures = BreakerClosed, 0
+		}
+		return
+	}
+	if b.state != BreakerClosed {
+		// a call let through before the breaker opened
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.policy.Failures {
+		b.openLocked()
+	}
+}
+
+func (b *circuitBreaker) openLocked() {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.failures = 0
+}
+
+// release gives back a probe whose outcome is unknown.
+func (b *circuitBreaker) release(probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	b.probes--
+	b.mu.Unlock()
+}
+
+// isBreakerFailure reports whether err says the address is down or too
+// slow, rather than the call being at fault.
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch connect.CodeOf(err) {
+	case connect.CodeUnavailable, connect.CodeDeadlineExceeded:
+		return true
+	case connect.CodeUnknown, connect.CodeInternal:
+		// the connection broke, rather than the server answering so
+		return !connect.IsWireError(err)
+	}
+	return false
+}
+
+type breakerInterceptor struct {
+	breaker *circuitBreaker
+}
+
+func newBreakerInterceptor(b *circuitBreaker) *breakerInterceptor {
+	return &breakerInterceptor{breaker: b}
+}
+
+func (i *breakerInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		probe, err := i.breaker.allow()
+		if err != nil {
+			return nil, err
+		}
+		res, err := next(ctx, req)
+		i.breaker.record(probe, err)
+		return res, err
+	}
+}
+
+func (i *breakerInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		probe, err := i.breaker.allow()
+		if err != nil {
+			return &failedStreamingClientConn{conn, err}
+		}
+		return &breakerStreamConn{StreamingClientConn: conn, breaker: i.breaker, probe: probe}
+	}
+}
+
+func (*breakerInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// breakerStreamConn records the outcome of a stream with its first
+// response, which is when the address has proven to be up, or not.
+type breakerStreamConn struct {
+	connect.StreamingClientConn
+	breaker *circuitBreaker
+	probe   bool
+	once    sync.Once
+}
+
+func (c *breakerStreamConn) Send(msg any) error {
+	err := c.StreamingClientConn.Send(msg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.once.Do(func() { c.breaker.record(c.probe, err) })
+	}
+	return err
+}
+
+func (c *breakerStreamConn) Receive(msg any) error {
+	err := c.StreamingClientConn.Receive(msg)
+	c.once.Do(func() {
+		if errors.Is(err, io.EOF) {
+			c.breaker.record(c.probe, nil)
+		} else {
+			c.breaker.record(c.probe, err)
+		}
+	})
+	return err
+}
+
+func (c *breakerStreamConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	c.once.Do(func() { c.breaker.release(c.probe) })
+	return err
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker("addr", &BreakerPolicy{Failures: 2, OpenDuration: 50 * time.Millisecond, HalfOpenProbes: 1})
+	unavailable := connect.NewError(connect.CodeUnavailable, errors.New("down"))
+	invalid := connect.NewError(connect.CodeInvalidArgument, errors.New("bad query"))
+
+	call := func(err error) error {
+		probe, allowErr := b.allow()
+		if allowErr != nil {
+			return allowErr
+		}
+		b.record(probe, err)
+		return err
+	}
+
+	// only consecutive unavailable errors count
+	assert.Equal(t, unavailable, call(unavailable))
+	assert.Equal(t, invalid, call(invalid))
+	assert.Equal(t, unavailable, call(unavailable))
+	assert.Equal(t, BreakerClosed, b.State())
+	require.NoError(t, call(nil))
+	call(unavailable)
+	call(unavailable)
+	assert.Equal(t, BreakerOpen, b.State())
+
+	err := call(nil)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, connect.CodeUnavailable, connect.CodeOf(err))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	probe, err := b.allow()
+	require.NoError(t, err)
+	assert.True(t, probe)
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen, "only one probe at a time")
+	b.record(probe, unavailable)
+	assert.Equal(t, BreakerOpen, b.State())
+
+	// a probe cancelled by the caller proves nothing either way
+	time.Sleep(60 * time.Millisecond)
+	call(connect.NewError(connect.CodeCanceled, context.Canceled))
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	require.NoError(t, call(nil))
+	assert.Equal(t, BreakerClosed, b.State())
+
+	// timeouts and broken connections count, cancellations don't
+	call(connect.NewError(connect.CodeDeadlineExceeded, context.DeadlineExceeded))
+	call(connect.NewError(connect.CodeCanceled, context.Canceled))
+	call(connect.NewError(connect.CodeUnknown, errors.New("unexpected EOF")))
+	assert.Equal(t, BreakerOpen, b.State())
+}
+
+func TestPoolCircuitBreaker(t *testing.T) {
+	db := &fakeDatabase{failures: map[string]int{psdbv1alpha1connect.DatabaseCreateSessionProcedure: 5}}
+	addr, opts := newTestServer(t, db)
+	policy := &BreakerPolicy{Failures: 2, OpenDuration: time.Hour, HalfOpenProbes: 1}
+	pool := NewUnauthenticatedPool(psdbv1alpha1connect.NewDatabaseClient, append(opts, WithCircuitBreaker(policy))...)
+	defer pool.Close()
+	ctx := context.Background()
+
+	assert.Empty(t, pool.BreakerStates())
+	for i := 0; i < 2; i++ {
+		_, err := pool.Get(addr).CreateSession(ctx, connect.NewRequest(&psdbv1alpha1.CreateSessionRequest{}))
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+	_, err := pool.Get(addr).CreateSession(ctx, connect.NewRequest(&psdbv1alpha1.CreateSessionRequest{}))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, db.attemptsOf(psdbv1alpha1connect.DatabaseCreateSessionProcedure))
+	assert.Equal(t, map[string]BreakerState{addr: BreakerOpen}, pool.BreakerStates())
+
+	// the breaker is per address, whatever the credentials
+	_, err = pool.GetWithAuth(addr, nil).CreateSession(ctx, connect.NewRequest(&psdbv1alpha1.CreateSessionRequest{}))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	stream, err := pool.Get(addr).StreamExecute(ctx, connect.NewRequest(&psdbv1alpha1.ExecuteRequest{}))
+	if err == nil {
+		assert.False(t, stream.Receive())
+		err = stream.Err()
+	}
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// an open breaker outlives the clients for its address
+	pool.Release(addr)
+	assert.Equal(t, map[string]BreakerState{addr: BreakerOpen}, pool.BreakerStates())
+}
+
+func TestPoolCircuitBreakerPruned(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	pool := NewUnauthenticatedPool(psdbv1alpha1connect.NewDatabaseClient, append(opts, WithCircuitBreaker(DefaultBreakerPolicy()))...)
+	defer pool.Close()
+
+	basic := auth.NewBasicAuth("user", "pass")
+	pool.Get(addr)
+	pool.GetWithAuth(addr, basic)
+	pool.ReleaseWithAuth(addr, basic)
+	assert.Equal(t, map[string]BreakerState{addr: BreakerClosed}, pool.BreakerStates(), "still in use")
+	pool.Release(addr)
+	assert.Empty(t, pool.BreakerStates())
+}
+
+func TestRetrySkipsOpenCircuit(t *testing.T) {
+	err := connect.NewError(connect.CodeUnavailable, ErrCircuitOpen)
+	assert.False(t, DefaultRetryFunc(psdbv1alpha1connect.DatabaseCreateSessionProcedure, nil, false, err))
+}
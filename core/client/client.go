@@ -4,7 +4,7 @@ import (
 	"crypto/tls"
 	"net"
 	"net/http"
-	"sync"
+	"slices"
 	"time"
 
 	"connectrpc.com/connect"
@@ -24,13 +24,22 @@ func (c *simpleClient) Do(req *http.Request) (*http.Response, error) {
 	return c.RoundTripper.RoundTrip(req)
 }
 
+func (c *simpleClient) CloseIdleConnections() {
+	if t, ok := c.RoundTripper.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+}
+
 const (
 	defaultCompressionName  = compress.S2
 	defaultCompressionLevel = compress.LevelFastest
 	// Slightly larger than the max message size allowed by edge gateway.
-	maxMessageSize = 100 * 1024 * 1024
+	defaultMaxMessageSize = 100 * 1024 * 1024
 )
 
+// New builds a client for the server at addr with fn, usually a generated
+// NewXxxClient. addr is dialed over TLS, unless it has one of the schemes
+// for local servers, SchemeUnix or SchemeH2C.
 func New[T any](
 	addr string,
 	fn func(connect.HTTPClient, string, ...connect.ClientOption) T,
@@ -39,114 +48,62 @@ func New[T any](
 ) T {
 	cfg := configFromOptions(opts...)
 
-	cOpts := append(defaultClientOptions(), connect.WithInterceptors(
-		&setHeadersInterceptor{
-			"Authorization",
-			auth.Type().String() + " " + auth.HeaderValue(),
-		},
-	))
-
-	if len(cfg.extraClientOptions) > 0 {
-		cOpts = append(cOpts, cfg.extraClientOptions...)
-	}
-
-	return fn(cfg.httpClient, "https://"+addr, cOpts...)
-}
+	cOpts := clientOptions(cfg, cfg.authInterceptor(auth))
 
-type ClientPool[T any] struct {
-	fn            func(connect.HTTPClient, string, ...connect.ClientOption) T
-	pool          map[string]T
-	poolMu        sync.RWMutex
-	cfg           *config
-	clientOptions []connect.ClientOption
+	return fn(cfg.httpClient, baseURL(addr), cOpts...)
 }
 
-func (p *ClientPool[T]) Get(addr string) T {
-	// First check the fast path, if there's already
-	// an initialized client for this address
-	p.poolMu.RLock()
-	client, ok := p.pool[addr]
-	p.poolMu.RUnlock()
-	if ok {
-		return client
+// authInterceptor authenticates calls with the CredentialsProvider
+// from the Options if there is one, and auth otherwise.
+func (c *config) authInterceptor(auth *auth.Authorization) connect.Interceptor {
+	if c.credentials != nil {
+		return newCredentialsInterceptor(c.credentials)
 	}
-
-	// create a new one outside a lock, worst case, we create multiple, last one wins
-	// and the others are GC'd
-	client = p.fn(p.cfg.httpClient, "https://"+addr, p.clientOptions...)
-
-	// lock the map to store the client
-	p.poolMu.Lock()
-	p.pool[addr] = client
-	p.poolMu.Unlock()
-
-	// finally, read from the map again to make sure we use the instance that
-	// was actually written. This is because of the race condition above where multiple
-	// instances were created but only one can be written into the map
-	p.poolMu.RLock()
-	client = p.pool[addr]
-	p.poolMu.RUnlock()
-	return client
+	return newAuthInterceptor(auth)
 }
 
-func (p *ClientPool[T]) Release(addr string) {
-	p.poolMu.Lock()
-	delete(p.pool, addr)
-	p.poolMu.Unlock()
-}
-
-func (p *ClientPool[T]) Len() int {
-	p.poolMu.RLock()
-	defer p.poolMu.RUnlock()
-	return len(p.pool)
-}
-
-func NewUnauthenticatedPool[T any](
-	fn func(connect.HTTPClient, string, ...connect.ClientOption) T,
-	opts ...Option,
-) *ClientPool[T] {
-	cfg := configFromOptions(opts...)
-
-	cOpts := defaultClientOptions()
+// clientOptions combines the defaults with everything configured through
+// Options. Interceptors from Options wrap the given interceptors, so they
+// see every attempt with its headers already set.
+func clientOptions(cfg *config, interceptors ...connect.Interceptor) []connect.ClientOption {
+	cOpts := append(defaultClientOptions(), cfg.compressionOptions()...)
+	cOpts = append(cOpts,
+		connect.WithReadMaxBytes(max(cfg.readMaxBytes, 0)),
+		connect.WithSendMaxBytes(max(cfg.sendMaxBytes, 0)),
+	)
+	if o := cfg.protocol.clientOption(); o != nil {
+		cOpts = append(cOpts, o)
+	}
+	// the size check is innermost, so every other interceptor sees its errors
+	all := slices.Concat(cfg.interceptors, interceptors, []connect.Interceptor{newSizeLimitInterceptor(cfg.sendMaxBytes)})
+	cOpts = append(cOpts, connect.WithInterceptors(all...))
 	if len(cfg.extraClientOptions) > 0 {
 		cOpts = append(cOpts, cfg.extraClientOptions...)
 	}
-
-	return &ClientPool[T]{
-		fn:            fn,
-		pool:          make(map[string]T),
-		cfg:           cfg,
-		clientOptions: cOpts,
-	}
+	return cOpts
 }
 
 func defaultClientOptions() []connect.ClientOption {
 	return []connect.ClientOption{
-		compress.WithNew(defaultCompressionName, defaultCompressionLevel),
-		connect.WithSendCompression(defaultCompressionName),
 		connect.WithCodec(codec.DefaultCodec),
-		connect.WithReadMaxBytes(maxMessageSize),
-		connect.WithSendMaxBytes(maxMessageSize),
 	}
 }
 
-func defaultHTTPClient(tlsConfig *tls.Config) connect.HTTPClient {
+func defaultTransport(tlsConfig *tls.Config) *http.Transport {
 	if tlsConfig == nil {
 		tlsConfig = DefaultTLSConfig()
 	}
-	return &simpleClient{
-		&http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			ForceAttemptHTTP2:     true,
-			MaxIdleConnsPerHost:   20,
-			IdleConnTimeout:       30 * time.Minute,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			DisableCompression:    true,
-			TLSClientConfig:       tlsConfig,
-		},
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConnsPerHost:   20,
+		IdleConnTimeout:       30 * time.Minute,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableCompression:    true,
+		TLSClientConfig:       tlsConfig,
 	}
 }
@@ -4,37 +4,126 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"net/http"
+	"net/url"
 	"os"
 	"sync"
+	"time"
 
 	"connectrpc.com/connect"
+	compress "github.com/klauspost/connect-compress/v2"
 )
 
 type config struct {
 	tlsConfig          *tls.Config
 	extraClientOptions []connect.ClientOption
 	httpClient         connect.HTTPClient
+	interceptors       []connect.Interceptor
+	credentials        CredentialsProvider
+	countWireBytes     bool
+	certReloader       *CertReloader
+	pins               []string
+	proxy              func(*http.Request) (*url.URL, error)
+	protocol           Protocol
+	sendCompression    string
+	compressionLevel   compress.Level
+	acceptCompression  []string
+	compressMinBytes   int
+	readMaxBytes       int
+	sendMaxBytes       int
+
+	poolMaxSize int
+	poolIdleTTL time.Duration
+	poolOnEvict func(addr string, reason EvictReason)
+
+	breakerPolicy *BreakerPolicy
+
+	loadBalancing LoadBalancing
+	healthPolicy  *HealthPolicy
 }
 
 func configFromOptions(opts ...Option) *config {
-	cfg := &config{}
+	cfg := &config{
+		sendCompression:  defaultCompressionName,
+		compressionLevel: defaultCompressionLevel,
+		readMaxBytes:     defaultMaxMessageSize,
+		sendMaxBytes:     defaultMaxMessageSize,
+	}
 	for _, o := range opts {
 		o(cfg)
 	}
 	if cfg.httpClient == nil {
-		cfg.httpClient = defaultHTTPClient(cfg.tlsConfig)
+		t := cfg.transport()
+		var remote http.RoundTripper = t
+		if cfg.certReloader != nil {
+			remote = newRecyclingTransport(t, cfg.certReloader, cfg.transportTLSConfig)
+		}
+		cfg.httpClient = &simpleClient{newLocalTransport(remote, t)}
+		if err := checkPinnable(cfg.tlsConfig); len(cfg.pins) > 0 && err != nil {
+			cfg.httpClient = unpinnedHTTPClient{err}
+		}
+	} else {
+		if len(cfg.pins) > 0 {
+			cfg.httpClient = pinnedHTTPClient(cfg.httpClient, cfg.pins)
+		}
+		if cfg.certReloader != nil {
+			cfg.httpClient = newReloadingHTTPClient(cfg.httpClient, cfg.certReloader)
+		}
+	}
+	if cfg.countWireBytes {
+		cfg.httpClient = &countingHTTPClient{cfg.httpClient}
 	}
 	return cfg
 }
 
 type Option func(*config)
 
+// transport is the default transport, as set up by the Options.
+func (c *config) transport() *http.Transport {
+	t := defaultTransport(c.transportTLSConfig())
+	t.Proxy = c.proxy
+	return t
+}
+
+// transportTLSConfig is the tls.Config for the default transport, with the
+// CertReloader and pins from the Options applied to it.
+func (c *config) transportTLSConfig() *tls.Config {
+	tlsConfig := c.tlsConfig
+	if c.certReloader != nil {
+		if tlsConfig == nil {
+			tlsConfig = c.certReloader.transportTLSConfig()
+		} else {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.GetClientCertificate = c.certReloader.GetClientCertificate
+		}
+	}
+	if len(c.pins) > 0 {
+		tlsConfig = withPinnedKeys(tlsConfig, c.pins)
+	}
+	return tlsConfig
+}
+
 func WithTLSConfig(cfg *tls.Config) Option {
 	return func(c *config) {
 		c.tlsConfig = cfg
 	}
 }
 
+// WithProxy sends requests through the proxy returned by proxy, as with
+// http.Transport.Proxy. Use http.ProxyFromEnvironment to follow the
+// HTTPS_PROXY and NO_PROXY environment variables, or http.ProxyURL for a
+// fixed proxy. An "http" or "https" proxy is used through CONNECT, with
+// the credentials in the URL, if any, sent in Proxy-Authorization.
+// A "socks5" or "socks5h" proxy is used with username and password
+// authentication when the URL has credentials. HTTP/2 is still negotiated
+// with the server over the tunnel. The proxy applies to the default
+// transport, and is ignored with WithHTTPClient.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(c *config) {
+		c.proxy = proxy
+	}
+}
+
 func WithHTTPClient(client connect.HTTPClient) Option {
 	return func(c *config) {
 		c.httpClient = client
@@ -47,6 +136,45 @@ func WithExtraClientOptions(opts ...connect.ClientOption) Option {
 	}
 }
 
+// WithRetryPolicy retries failed calls according to policy.
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(c *config) {
+		c.interceptors = append(c.interceptors, newRetryInterceptor(policy))
+	}
+}
+
+// WithPoolMaxSize limits a ClientPool to n entries, evicting the least
+// recently used entry to make room for a new one.
+func WithPoolMaxSize(n int) Option {
+	return func(c *config) {
+		c.poolMaxSize = n
+	}
+}
+
+// WithPoolIdleTTL evicts ClientPool entries that haven't been used for ttl.
+// Idle entries are swept in the background until the pool is closed.
+func WithPoolIdleTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.poolIdleTTL = ttl
+	}
+}
+
+// WithPoolEvictionCallback calls fn whenever an entry leaves a ClientPool.
+func WithPoolEvictionCallback(fn func(addr string, reason EvictReason)) Option {
+	return func(c *config) {
+		c.poolOnEvict = fn
+	}
+}
+
+// WithCredentialsProvider asks provider for credentials on every call,
+// instead of using the fixed credentials given to New. It also
+// authenticates the clients returned by ClientPool.Get.
+func WithCredentialsProvider(provider CredentialsProvider) Option {
+	return func(c *config) {
+		c.credentials = provider
+	}
+}
+
 var (
 	defaultTLSConfig     *tls.Config
 	defaultTLSConfigOnce sync.Once
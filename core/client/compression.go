@@ -0,0 +1,115 @@
+package client
+
+import (
+	"io"
+	"slices"
+
+	"connectrpc.com/connect"
+	"github.com/klauspost/compress/zstd"
+	compress "github.com/klauspost/connect-compress/v2"
+)
+
+// CompressionNone sends requests uncompressed.
+const CompressionNone = "identity"
+
+// WithSendCompression compresses requests with name at level. name is
+// compress.S2, the default, compress.Snappy, compress.Zstandard,
+// compress.Gzip or CompressionNone. The server must support it, or calls
+// fail with CodeUnimplemented. Unless set by WithAcceptCompression, it is
+// also the only compression asked of the server for responses, besides
+// gzip which is always accepted.
+func WithSendCompression(name string, level compress.Level) Option {
+	return func(c *config) {
+		c.sendCompression = name
+		c.compressionLevel = level
+	}
+}
+
+// WithAcceptCompression asks the server to compress responses with any of
+// names, in order of preference. The server picks the first it supports,
+// and falls back to gzip, then to no compression.
+func WithAcceptCompression(names ...string) Option {
+	return func(c *config) {
+		c.acceptCompression = names
+	}
+}
+
+// WithCompressMinBytes sends requests smaller than n bytes uncompressed,
+// as compressing them costs more than it saves.
+func WithCompressMinBytes(n int) Option {
+	return func(c *config) {
+		c.compressMinBytes = n
+	}
+}
+
+// compressionOptions registers the compressors from the Options.
+func (c *config) compressionOptions() []connect.ClientOption {
+	accept := c.acceptCompression
+	if len(accept) == 0 {
+		accept = []string{c.sendCompression}
+	}
+	if !slices.Contains(accept, c.sendCompression) {
+		// registered, but the least preferred for responses
+		accept = append(slices.Clone(accept), c.sendCompression)
+	}
+	var opts []connect.ClientOption
+	for _, name := range accept {
+		switch name {
+		case CompressionNone:
+		case compress.Zstandard:
+			newDecompressor, newCompressor := zstdCompression(c.compressionLevel)
+			opts = append(opts, connect.WithAcceptCompression(name, newDecompressor, newCompressor))
+		default:
+			opts = append(opts, compress.WithNew(name, c.compressionLevel))
+		}
+	}
+	// the compressor registered last is the most preferred, so reverse
+	slices.Reverse(opts)
+	opts = append(opts, connect.WithSendCompression(c.sendCompression))
+	if c.compressMinBytes > 0 {
+		opts = append(opts, connect.WithCompressMinBytes(c.compressMinBytes))
+	}
+	return opts
+}
+
+// zstdCompression returns zstd constructors set up like the ones from
+// compress.WithNew, except that decompressors can be reused. connect
+// closes a decompressor before putting it back in its pool, which leaves
+// a zstd.Decoder unusable.
+func zstdCompression(level compress.Level) (func() connect.Decompressor, func() connect.Compressor) {
+	eopts := []zstd.EOption{
+		zstd.WithLowerEncoderMem(true),
+		zstd.WithEncoderConcurrency(1),
+		zstd.WithWindowSize(1 << 20),
+	}
+	switch level {
+	case compress.LevelFastest:
+		eopts = append(eopts, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	case compress.LevelBalanced:
+		eopts = append(eopts, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	case compress.LevelSmallest:
+		eopts = append(eopts, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithWindowSize(4<<20))
+	}
+	return func() connect.Decompressor {
+			// NewReader only fails on bad options
+			d, _ := zstd.NewReader(nil, zstd.WithDecoderLowmem(true), zstd.WithDecoderConcurrency(1))
+			return &zstdDecompressor{d}
+		}, func() connect.Compressor {
+			// NewWriter only fails on bad options
+			e, _ := zstd.NewWriter(nil, eopts...)
+			return e
+		}
+}
+
+type zstdDecompressor struct {
+	*zstd.Decoder
+}
+
+func (d *zstdDecompressor) Reset(r io.Reader) error {
+	return d.Decoder.Reset(r)
+}
+
+// Close releases the input, but keeps the decoder usable.
+func (d *zstdDecompressor) Close() error {
+	return d.Decoder.Reset(nil)
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"connectrpc.com/connect"
+	compress "github.com/klauspost/connect-compress/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	"github.com/planetscale/psdb/core/codec"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+type encodings struct {
+	request, response string
+}
+
+func encodingOf(h http.Header) string {
+	return h.Get("Content-Encoding") + h.Get("Connect-Content-Encoding")
+}
+
+// newZstdTestServer starts a server that only supports zstd, besides the
+// gzip every connect handler supports, and records the encodings of every
+// call.
+func newZstdTestServer(t *testing.T) (string, []Option, func() []encodings) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		seen []encodings
+	)
+	d, c := zstdCompression(compress.LevelFastest)
+	path, h := psdbv1alpha1connect.NewDatabaseHandler(&fakeDatabase{},
+		connect.WithCompression(compress.Zstandard, d, c),
+		connect.WithCodec(codec.DefaultCodec),
+	)
+	mux := http.NewServeMux()
+	mux.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		mu.Lock()
+		seen = append(seen, encodings{encodingOf(r.Header), encodingOf(w.Header())})
+		mu.Unlock()
+	}))
+	srv := httptest.NewUnstartedServer(mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.Listener.Addr().String(), []Option{WithHTTPClient(srv.Client())}, func() []encodings {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen
+	}
+}
+
+func TestCompressionUnsupported(t *testing.T) {
+	addr, opts, _ := newZstdTestServer(t)
+	_, err := Dial(context.Background(), addr, auth.NewBasicAuth("user", "pass"), opts...)
+	assert.Equal(t, connect.CodeUnimplemented, connect.CodeOf(err))
+}
+
+func TestCompressionNegotiated(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []Option
+		want encodings
+	}{
+		{
+			name: "zstd",
+			opts: []Option{
+				WithSendCompression(compress.Zstandard, compress.LevelBalanced),
+				WithAcceptCompression(compress.S2, compress.Zstandard),
+			},
+			want: encodings{compress.Zstandard, compress.Zstandard},
+		},
+		{
+			name: "none",
+			opts: []Option{
+				WithSendCompression(CompressionNone, compress.LevelFastest),
+				WithAcceptCompression(compress.S2, compress.Snappy),
+			},
+			want: encodings{"", compress.Gzip},
+		},
+		{
+			name: "gzip",
+			opts: []Option{WithSendCompression(compress.Gzip, compress.LevelSmallest)},
+			want: encodings{compress.Gzip, compress.Gzip},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addr, opts, seen := newZstdTestServer(t)
+			ctx := context.Background()
+			conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), append(opts, c.opts...)...)
+			require.NoError(t, err)
+			_, err = conn.Execute(ctx, "select 1", nil)
+			require.NoError(t, err)
+			stream, err := conn.StreamExecute(ctx, "select 1", nil)
+			require.NoError(t, err)
+			for stream.Receive() {
+			}
+			require.NoError(t, stream.Err())
+
+			assert.Equal(t, []encodings{c.want, c.want, c.want}, seen())
+		})
+	}
+}
+
+func TestAcceptCompressionOrder(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	_, err := Dial(context.Background(), addr, auth.NewBasicAuth("user", "pass"), append(opts,
+		WithSendCompression(compress.Zstandard, compress.LevelFastest),
+		WithAcceptCompression(compress.S2, compress.Snappy),
+	)...)
+	require.NoError(t, err)
+	assert.Equal(t, "s2,snappy,zstd,gzip", db.headers[0].Get("Accept-Encoding"))
+}
+
+func TestCompressMinBytes(t *testing.T) {
+	addr, opts, seen := newZstdTestServer(t)
+	ctx := context.Background()
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), append(opts,
+		WithSendCompression(compress.Zstandard, compress.LevelFastest),
+		WithCompressMinBytes(1024),
+	)...)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "select '"+strings.Repeat("x", 2048)+"'", nil)
+	require.NoError(t, err)
+
+	got := seen()
+	require.Len(t, got, 2)
+	assert.Equal(t, "", got[0].request)
+	assert.Equal(t, compress.Zstandard, got[1].request)
+}
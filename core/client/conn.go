@@ -0,0 +1,235 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"connectrpc.com/connect"
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+
+	"github.com/planetscale/psdb/auth"
+	psdberrors "github.com/planetscale/psdb/core/errors"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+var ErrConnClosed = errors.New("psdb: connection is closed")
+
+// Conn wraps a DatabaseClient and owns a single server side Session.
+// Every request carries the current Session, and every response replaces
+// it, so callers never have to thread the Session through by hand.
+// An RPCError in a response is returned as a *psdberrors.Error.
+//
+// Statements on a Conn are serialized, since a vitess Session can only
+// make progress one statement at a time.
+type Conn struct {
+	client psdbv1alpha1connect.DatabaseClient
+
+	// mu is held for the duration of each statement, including
+	// while a StreamExecute is being consumed.
+	mu     sync.Mutex
+	closed bool
+
+	sessionMu sync.RWMutex
+	session   *psdbv1alpha1.Session
+}
+
+// Dial builds a DatabaseClient through New and opens a Session on it.
+func Dial(
+	ctx context.Context,
+	addr string,
+	auth *auth.Authorization,
+	opts ...Option,
+) (*Conn, error) {
+	return NewConn(ctx, New(addr, psdbv1alpha1connect.NewDatabaseClient, auth, opts...))
+}
+
+// NewConn opens a Session on an existing DatabaseClient.
+func NewConn(ctx context.Context, client psdbv1alpha1connect.DatabaseClient) (*Conn, error) {
+	res, err := client.CreateSession(ctx, connect.NewRequest(&psdbv1alpha1.CreateSessionRequest{}))
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{
+		client:  client,
+		session: res.Msg.GetSession(),
+	}, nil
+}
+
+// Session returns the most recent Session returned by the server.
+func (c *Conn) Session() *psdbv1alpha1.Session {
+	c.sessionMu.RLock()
+	defer c.sessionMu.RUnlock()
+	return c.session
+}
+
+// Signature returns the signature of the current Session.
+func (c *Conn) Signature() []byte {
+	return c.Session().GetSignature()
+}
+
+// InTransaction reports whether the current Session has an open transaction.
+func (c *Conn) InTransaction() bool {
+	return c.Session().GetVitessSession().GetInTransaction()
+}
+
+func (c *Conn) Execute(
+	ctx context.Context,
+	query string,
+	bindVars map[string]*querypb.BindVariable,
+) (*psdbv1alpha1.ExecuteResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrConnClosed
+	}
+
+	res, err := c.client.Execute(ctx, connect.NewRequest(&psdbv1alpha1.ExecuteRequest{
+		Session:       c.Session(),
+		Query:         query,
+		BindVariables: bindVars,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	c.updateSession(res.Msg.GetSession())
+	if err := psdberrors.New(res.Msg.GetError()); err != nil {
+		return nil, err
+	}
+	return res.Msg, nil
+}
+
+// StreamExecute starts a streaming query. The Conn is busy until the
+// returned stream is closed, or Receive returns false.
+func (c *Conn) StreamExecute(
+	ctx context.Context,
+	query string,
+	bindVars map[string]*querypb.BindVariable,
+) (*ExecuteStream, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrConnClosed
+	}
+
+	stream, err := c.client.StreamExecute(ctx, connect.NewRequest(&psdbv1alpha1.ExecuteRequest{
+		Session:       c.Session(),
+		Query:         query,
+		BindVariables: bindVars,
+	}))
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	return &ExecuteStream{conn: c, stream: stream}, nil
+}
+
+func (c *Conn) Prepare(
+	ctx context.Context,
+	query string,
+	bindVars map[string]*querypb.BindVariable,
+) (*psdbv1alpha1.PrepareResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrConnClosed
+	}
+
+	res, err := c.client.Prepare(ctx, connect.NewRequest(&psdbv1alpha1.PrepareRequest{
+		Session:       c.Session(),
+		Query:         query,
+		BindVariables: bindVars,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	c.updateSession(res.Msg.GetSession())
+	if err := psdberrors.New(res.Msg.GetError()); err != nil {
+		return nil, err
+	}
+	return res.Msg, nil
+}
+
+// Close closes the Session on the server. Calling Close more than once
+// is a no-op. If the server can't be reached, the Conn stays open, so
+// Close can be retried.
+func (c *Conn) Close(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+
+	res, err := c.client.CloseSession(ctx, connect.NewRequest(&psdbv1alpha1.CloseSessionRequest{
+		Session: c.Session(),
+	}))
+	if err != nil {
+		return err
+	}
+	c.closed = true
+	c.updateSession(res.Msg.GetSession())
+	return psdberrors.New(res.Msg.GetError())
+}
+
+func (c *Conn) updateSession(session *psdbv1alpha1.Session) {
+	// a response without a Session, such as a failed statement,
+	// leaves the previous one in place
+	if session == nil {
+		return
+	}
+	c.sessionMu.Lock()
+	c.session = session
+	c.sessionMu.Unlock()
+}
+
+// ExecuteStream is a StreamExecute in progress on a Conn.
+type ExecuteStream struct {
+	conn     *Conn
+	stream   *connect.ServerStreamForClient[psdbv1alpha1.ExecuteResponse]
+	err      error
+	released bool
+}
+
+// Receive advances the stream to the next message, updating the Conn's
+// Session along the way. It stops at the first message carrying an
+// RPCError. Once it returns false, the Conn is released.
+func (s *ExecuteStream) Receive() bool {
+	if s.released {
+		return false
+	}
+	if !s.stream.Receive() {
+		s.release()
+		return false
+	}
+	s.conn.updateSession(s.stream.Msg().GetSession())
+	if s.err = psdberrors.New(s.stream.Msg().GetError()); s.err != nil {
+		s.release()
+		return false
+	}
+	return true
+}
+
+func (s *ExecuteStream) Msg() *psdbv1alpha1.ExecuteResponse {
+	return s.stream.Msg()
+}
+
+func (s *ExecuteStream) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.stream.Err()
+}
+
+func (s *ExecuteStream) Close() error {
+	err := s.stream.Close()
+	s.release()
+	return err
+}
+
+func (s *ExecuteStream) release() {
+	if !s.released {
+		s.released = true
+		s.conn.mu.Unlock()
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	psdberrors "github.com/planetscale/psdb/core/errors"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+func TestConn(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	ctx := context.Background()
+
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), opts...)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), conn.Signature())
+	assert.Equal(t, "Basic dXNlcjpwYXNz", db.headers[0].Get("Authorization"))
+
+	_, err = conn.Execute(ctx, "begin", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), db.lastReceived().GetSignature())
+	assert.Equal(t, []byte("2"), conn.Signature())
+	assert.True(t, conn.InTransaction())
+
+	stream, err := conn.StreamExecute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	n := 0
+	for stream.Receive() {
+		n++
+	}
+	require.NoError(t, stream.Err())
+	require.NoError(t, stream.Close())
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []byte("5"), conn.Signature())
+
+	_, err = conn.Prepare(ctx, "select ?", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("5"), db.lastReceived().GetSignature())
+
+	_, err = conn.Execute(ctx, "duplicate", nil)
+	assert.True(t, psdberrors.IsDuplicateKey(err))
+	assert.Equal(t, []byte("7"), conn.Signature())
+
+	_, err = conn.Execute(ctx, "commit", nil)
+	require.NoError(t, err)
+	assert.False(t, conn.InTransaction())
+
+	require.NoError(t, conn.Close(ctx))
+	assert.True(t, db.closed)
+	assert.Equal(t, []byte("8"), db.lastReceived().GetSignature())
+	require.NoError(t, conn.Close(ctx))
+
+	_, err = conn.Execute(ctx, "select 1", nil)
+	assert.ErrorIs(t, err, ErrConnClosed)
+}
+
+func TestConnStreamReleasesOnClose(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	ctx := context.Background()
+
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), opts...)
+	require.NoError(t, err)
+
+	stream, err := conn.StreamExecute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	require.True(t, stream.Receive())
+	require.NoError(t, stream.Close())
+	assert.False(t, stream.Receive())
+
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+}
+
+func TestConnCloseRetry(t *testing.T) {
+	db := &fakeDatabase{failures: map[string]int{psdbv1alpha1connect.DatabaseCloseSessionProcedure: 1}}
+	addr, opts := newTestServer(t, db)
+	ctx := context.Background()
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), opts...)
+	require.NoError(t, err)
+
+	err = conn.Close(ctx)
+	assert.Equal(t, connect.CodeUnavailable, connect.CodeOf(err))
+	assert.False(t, db.closed)
+
+	// the Conn is still usable, and Close can be retried
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close(ctx))
+	assert.True(t, db.closed)
+}
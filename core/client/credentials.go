@@ -0,0 +1,229 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+
+	"github.com/planetscale/psdb/auth"
+)
+
+var ErrNoCredentials = errors.New("no credentials available")
+
+// CredentialsProvider returns the credentials to send with a request.
+// It is asked on every call, so implementations should cache.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (*auth.Authorization, error)
+}
+
+// CredentialsFunc adapts a function into a CredentialsProvider.
+type CredentialsFunc func(ctx context.Context) (*auth.Authorization, error)
+
+func (f CredentialsFunc) Credentials(ctx context.Context) (*auth.Authorization, error) {
+	return f(ctx)
+}
+
+// StaticCredentials always returns a.
+func StaticCredentials(a *auth.Authorization) CredentialsProvider {
+	return CredentialsFunc(func(context.Context) (*auth.Authorization, error) {
+		return a, nil
+	})
+}
+
+// EnvCredentials reads a username and password from environment variables
+// on every call, building new Basic credentials only when they change.
+func EnvCredentials(usernameVar, passwordVar string) CredentialsProvider {
+	return &envCredentials{usernameVar: usernameVar, passwordVar: passwordVar}
+}
+
+type envCredentials struct {
+	usernameVar, passwordVar string
+
+	mu                 sync.Mutex
+	username, password string
+	auth               *auth.Authorization
+}
+
+func (e *envCredentials) Credentials(context.Context) (*auth.Authorization, error) {
+	username, password := os.Getenv(e.usernameVar), os.Getenv(e.passwordVar)
+	if username == "" {
+		return nil, fmt.Errorf("%w: %s is not set", ErrNoCredentials, e.usernameVar)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.auth == nil || username != e.username || password != e.password {
+		e.username, e.password = username, password
+		e.auth = auth.NewBasicAuth(username, password)
+	}
+	return e.auth, nil
+}
+
+// FileCredentials reads Basic credentials from a file containing
+// username:password. The file is checked for changes at most once per
+// checkInterval, and reloaded when its size or modification time changes.
+// If a reload fails, the last good credentials keep being used.
+func FileCredentials(path string, checkInterval time.Duration) CredentialsProvider {
+	return &fileCredentials{path: path, checkInterval: checkInterval}
+}
+
+type fileCredentials struct {
+	path          string
+	checkInterval time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	modTime   time.Time
+	size      int64
+	auth      *auth.Authorization
+}
+
+func (f *fileCredentials) Credentials(context.Context) (*auth.Authorization, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if f.auth != nil && now.Sub(f.checkedAt) < f.checkInterval {
+		return f.auth, nil
+	}
+	f.checkedAt = now
+
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return f.lastGood(err)
+	}
+	if f.auth != nil && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return f.auth, nil
+	}
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return f.lastGood(err)
+	}
+	username, password, ok := bytes.Cut(bytes.TrimSpace(b), []byte(":"))
+	if !ok || len(username) == 0 {
+		return f.lastGood(fmt.Errorf("%w: %s is not username:password", ErrNoCredentials, f.path))
+	}
+	f.auth = auth.NewBasicAuth(string(username), string(password))
+	f.modTime, f.size = fi.ModTime(), fi.Size()
+	return f.auth, nil
+}
+
+func (f *fileCredentials) lastGood(err error) (*auth.Authorization, error) {
+	if f.auth != nil {
+		return f.auth, nil
+	}
+	return nil, err
+}
+
+// CachingCredentials remembers the credentials returned by p for ttl.
+// Errors are not cached.
+func CachingCredentials(p CredentialsProvider, ttl time.Duration) CredentialsProvider {
+	return &cachingCredentials{provider: p, ttl: ttl}
+}
+
+type cachingCredentials struct {
+	provider CredentialsProvider
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	auth      *auth.Authorization
+	expiresAt time.Time
+}
+
+func (c *cachingCredentials) Credentials(ctx context.Context) (*auth.Authorization, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.auth != nil && time.Now().Before(c.expiresAt) {
+		return c.auth, nil
+	}
+	a, err := c.provider.Credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.auth, c.expiresAt = a, time.Now().Add(c.ttl)
+	return a, nil
+}
+
+// credentialsInterceptor sets the Authorization header from a
+// CredentialsProvider on every call.
+type credentialsInterceptor struct {
+	provider CredentialsProvider
+
+	// last caches the header for the most recent credentials,
+	// which are usually the same from one call to the next
+	mu     sync.Mutex
+	last   *auth.Authorization
+	header string
+}
+
+func newCredentialsInterceptor(provider CredentialsProvider) *credentialsInterceptor {
+	return &credentialsInterceptor{provider: provider}
+}
+
+func (i *credentialsInterceptor) headerValue(ctx context.Context) (string, error) {
+	a, err := i.provider.Credentials(ctx)
+	if err != nil {
+		return "", connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	if a == nil {
+		return "", connect.NewError(connect.CodeUnauthenticated, ErrNoCredentials)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if a != i.last {
+		i.last, i.header = a, authorizationHeader(a)
+	}
+	return i.header, nil
+}
+
+func (i *credentialsInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		value, err := i.headerValue(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header()["Authorization"] = []string{value}
+		return next(ctx, req)
+	}
+}
+
+func (i *credentialsInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		value, err := i.headerValue(ctx)
+		if err != nil {
+			return &failedStreamingClientConn{conn, err}
+		}
+		conn.RequestHeader()["Authorization"] = []string{value}
+		return conn
+	}
+}
+
+func (*credentialsInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// failedStreamingClientConn fails a stream before anything is sent.
+type failedStreamingClientConn struct {
+	connect.StreamingClientConn
+	err error
+}
+
+func (c *failedStreamingClientConn) Send(any) error {
+	return c.err
+}
+
+func (c *failedStreamingClientConn) Receive(any) error {
+	return c.err
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+func TestCredentialsProvider(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	ctx := context.Background()
+
+	current := auth.NewBasicAuth("alice", "a")
+	provider := CredentialsFunc(func(context.Context) (*auth.Authorization, error) {
+		return current, nil
+	})
+	conn, err := Dial(ctx, addr, nil, append(opts, WithCredentialsProvider(provider))...)
+	require.NoError(t, err)
+
+	current = auth.NewBasicAuth("bob", "b")
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	stream, err := conn.StreamExecute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	for stream.Receive() {
+	}
+	require.NoError(t, stream.Err())
+
+	assert.Equal(t, "Basic YWxpY2U6YQ==", db.headers[0].Get("Authorization"))
+	assert.Equal(t, "Basic Ym9iOmI=", db.headers[1].Get("Authorization"))
+	assert.Equal(t, "Basic Ym9iOmI=", db.headers[2].Get("Authorization"))
+}
+
+func TestCredentialsProviderError(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	ctx := context.Background()
+
+	boom := errors.New("boom")
+	provider := CredentialsFunc(func(context.Context) (*auth.Authorization, error) {
+		return nil, boom
+	})
+	client := New(addr, psdbv1alpha1connect.NewDatabaseClient, nil, append(opts, WithCredentialsProvider(provider))...)
+
+	_, err := client.CreateSession(ctx, connect.NewRequest(&psdbv1alpha1.CreateSessionRequest{}))
+	assert.Equal(t, connect.CodeUnauthenticated, connect.CodeOf(err))
+	assert.ErrorIs(t, err, boom)
+
+	stream, err := client.StreamExecute(ctx, connect.NewRequest(&psdbv1alpha1.ExecuteRequest{}))
+	if err == nil {
+		assert.False(t, stream.Receive())
+		err = stream.Err()
+	}
+	assert.Equal(t, connect.CodeUnauthenticated, connect.CodeOf(err))
+	assert.Empty(t, db.headers)
+}
+
+func TestEnvCredentials(t *testing.T) {
+	ctx := context.Background()
+	provider := EnvCredentials("PSDB_TEST_USERNAME", "PSDB_TEST_PASSWORD")
+
+	t.Setenv("PSDB_TEST_USERNAME", "")
+	_, err := provider.Credentials(ctx)
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	t.Setenv("PSDB_TEST_USERNAME", "alice")
+	t.Setenv("PSDB_TEST_PASSWORD", "a")
+	a1, err := provider.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", a1.Username())
+	a2, err := provider.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Same(t, a1, a2)
+
+	t.Setenv("PSDB_TEST_PASSWORD", "b")
+	a3, err := provider.Credentials(ctx)
+	require.NoError(t, err)
+	assert.NotSame(t, a1, a3)
+	assert.Equal(t, authorizationHeader(auth.NewBasicAuth("alice", "b")), authorizationHeader(a3))
+}
+
+func TestFileCredentials(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "credentials")
+	provider := FileCredentials(path, 0)
+
+	_, err := provider.Credentials(ctx)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(path, []byte("alice:a\n"), 0o600))
+	a, err := provider.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, authorizationHeader(auth.NewBasicAuth("alice", "a")), authorizationHeader(a))
+
+	require.NoError(t, os.WriteFile(path, []byte("robert:bb\n"), 0o600))
+	a, err = provider.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, authorizationHeader(auth.NewBasicAuth("robert", "bb")), authorizationHeader(a))
+
+	// a broken or missing file keeps the last good credentials
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o600))
+	a, err = provider.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "robert", a.Username())
+	require.NoError(t, os.Remove(path))
+	a, err = provider.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "robert", a.Username())
+}
+
+func TestCachingCredentials(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	provider := CachingCredentials(CredentialsFunc(func(context.Context) (*auth.Authorization, error) {
+		calls++
+		return auth.NewBasicAuth("alice", "a"), nil
+	}), 50*time.Millisecond)
+
+	a1, err := provider.Credentials(ctx)
+	require.NoError(t, err)
+	a2, err := provider.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Same(t, a1, a2)
+	assert.Equal(t, 1, calls)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = provider.Credentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,250 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+
+	"github.com/planetscale/psdb/auth"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+// HedgePolicy decides when a read is sent a second time.
+type HedgePolicy struct {
+	// Percentile of recent Execute latencies, between 0 and 1, after
+	// which a hedge is sent if the first copy hasn't answered.
+	Percentile float64
+	// InitialDelay is used until Window latencies have been seen.
+	InitialDelay time.Duration
+	// MinDelay keeps hedges from doubling the load when
+	// latencies are uniformly low.
+	MinDelay time.Duration
+	// Window is the number of recent latencies the percentile
+	// is taken over.
+	Window int
+}
+
+func DefaultHedgePolicy() *HedgePolicy {
+	return &HedgePolicy{
+		Percentile:   0.95,
+		InitialDelay: 50 * time.Millisecond,
+		MinDelay:     5 * time.Millisecond,
+		Window:       128,
+	}
+}
+
+type HedgeStats struct {
+	// Hedged is the number of Executes eligible for a hedge.
+	Hedged uint64
+	// Sent is the number of hedges sent, after the first copy
+	// took longer than the delay.
+	Sent uint64
+	// Won is the number of hedges that answered first.
+	Won uint64
+}
+
+// HedgedClient is a DatabaseClient that sends a read-only Execute to a
+// second address when the first is slow to answer, and returns whichever
+// succeeds first, cancelling the other. Writes, and anything in a
+// transaction, are only ever sent once, to the first address, as are
+// every other call. When a hedge wins, the Session it was sent is returned
+// in place of the one from the second address, so the caller carries on
+// with the first.
+type HedgedClient struct {
+	policy  *HedgePolicy
+	clients func() []psdbv1alpha1connect.DatabaseClient
+	next    atomic.Uint64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	pos       int
+	delay     time.Duration
+	dirty     bool
+
+	hedged, sent, won atomic.Uint64
+}
+
+// NewHedgedClient hedges reads across clients, the first one being
+// the primary. A nil policy uses DefaultHedgePolicy.
+func NewHedgedClient(policy *HedgePolicy, clients ...psdbv1alpha1connect.DatabaseClient) *HedgedClient {
+	return newHedgedClient(policy, func() []psdbv1alpha1connect.DatabaseClient { return clients })
+}
+
+// NewHedgedPoolClient hedges reads across the clients a ClientPool holds
+// for addrs, the first one being the primary. With a nil auth, the pool's
+// unauthenticated clients are used.
+func NewHedgedPoolClient(
+	policy *HedgePolicy,
+	pool *ClientPool[psdbv1alpha1connect.DatabaseClient],
+	auth *auth.Authorization,
+	addrs ...string,
+) *HedgedClient {
+	return newHedgedClient(policy, func() []psdbv1alpha1connect.DatabaseClient {
+		clients := make([]psdbv1alpha1connect.DatabaseClient, len(addrs))
+		for i, addr := range addrs {
+			if auth != nil {
+				clients[i] = pool.GetWithAuth(addr, auth)
+			} else {
+				clients[i] = pool.Get(addr)
+			}
+		}
+		return clients
+	})
+}
+
+func newHedgedClient(policy *HedgePolicy, clients func() []psdbv1alpha1connect.DatabaseClient) *HedgedClient {
+	if policy == nil {
+		policy = DefaultHedgePolicy()
+	}
+	return &HedgedClient{
+		policy:    policy,
+		clients:   clients,
+		latencies: make([]time.Duration, 0, policy.Window),
+		delay:     policy.InitialDelay,
+	}
+}
+
+func (h *HedgedClient) Stats() HedgeStats {
+	return HedgeStats{
+		Hedged: h.hedged.Load(),
+		Sent:   h.sent.Load(),
+		Won:    h.won.Load(),
+	}
+}
+
+func (h *HedgedClient) primary() psdbv1alpha1connect.DatabaseClient {
+	return h.clients()[0]
+}
+
+func (h *HedgedClient) CreateSession(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.CreateSessionRequest],
+) (*connect.Response[psdbv1alpha1.CreateSessionResponse], error) {
+	return h.primary().CreateSession(ctx, req)
+}
+
+func (h *HedgedClient) StreamExecute(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.ExecuteRequest],
+) (*connect.ServerStreamForClient[psdbv1alpha1.ExecuteResponse], error) {
+	return h.primary().StreamExecute(ctx, req)
+}
+
+func (h *HedgedClient) Prepare(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.PrepareRequest],
+) (*connect.Response[psdbv1alpha1.PrepareResponse], error) {
+	return h.primary().Prepare(ctx, req)
+}
+
+func (h *HedgedClient) CloseSession(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.CloseSessionRequest],
+) (*connect.Response[psdbv1alpha1.CloseSessionResponse], error) {
+	return h.primary().CloseSession(ctx, req)
+}
+
+type hedgeResult struct {
+	res   *connect.Response[psdbv1alpha1.ExecuteResponse]
+	err   error
+	hedge bool
+}
+
+func (h *HedgedClient) Execute(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.ExecuteRequest],
+) (*connect.Response[psdbv1alpha1.ExecuteResponse], error) {
+	clients := h.clients()
+	if len(clients) < 2 ||
+		req.Msg.GetSession().GetVitessSession().GetInTransaction() ||
+		!isReadOnlyQuery(req.Msg.GetQuery()) {
+		return clients[0].Execute(ctx, req)
+	}
+	h.hedged.Add(1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	// cancelling ctx on the way out cancels the loser
+	defer cancel()
+	// copy the request up front, as interceptors on
+	// the primary change its headers
+	hreq := connect.NewRequest(req.Msg)
+	for k, v := range req.Header() {
+		hreq.Header()[k] = slices.Clone(v)
+	}
+	results := make(chan hedgeResult, 2)
+	execute := func(client psdbv1alpha1connect.DatabaseClient, r *connect.Request[psdbv1alpha1.ExecuteRequest], hedge bool) {
+		res, err := client.Execute(ctx, r)
+		results <- hedgeResult{res, err, hedge}
+	}
+	start := time.Now()
+	go execute(clients[0], req, false)
+
+	timer := time.NewTimer(h.hedgeDelay())
+	defer timer.Stop()
+	pending := 1
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			h.sent.Add(1)
+			pending++
+			hedge := clients[1+int(h.next.Add(1)-1)%(len(clients)-1)]
+			go execute(hedge, hreq, true)
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// the latency the caller saw, which is also the least the
+				// primary took when the hedge won, keeps the delay from
+				// shrinking to the latency of hedges alone
+				h.observe(time.Since(start))
+				if r.hedge {
+					h.won.Add(1)
+					r.res.Msg.Session = req.Msg.GetSession()
+				}
+				return r.res, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			// a failure before the delay isn't hedged,
+			// that's a job for retries
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// hedgeDelay is the configured percentile of recent latencies.
+func (h *HedgedClient) hedgeDelay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.dirty && len(h.latencies) == h.policy.Window {
+		sorted := slices.Clone(h.latencies)
+		slices.Sort(sorted)
+		i := int(float64(len(sorted)-1) * h.policy.Percentile)
+		h.delay = max(sorted[i], h.policy.MinDelay)
+		h.dirty = false
+	}
+	return h.delay
+}
+
+func (h *HedgedClient) observe(latency time.Duration) {
+	if h.policy.Window <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < h.policy.Window {
+		h.latencies = append(h.latencies, latency)
+	} else {
+		h.latencies[h.pos] = latency
+		h.pos = (h.pos + 1) % h.policy.Window
+	}
+	h.dirty = true
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+func newHedgeTestClients(t *testing.T, dbs ...*fakeDatabase) []psdbv1alpha1connect.DatabaseClient {
+	clients := make([]psdbv1alpha1connect.DatabaseClient, len(dbs))
+	for i, db := range dbs {
+		addr, opts := newTestServer(t, db)
+		clients[i] = New(addr, psdbv1alpha1connect.NewDatabaseClient, auth.NewBasicAuth("user", "pass"), opts...)
+	}
+	return clients
+}
+
+func TestHedgedClient(t *testing.T) {
+	slow := &fakeDatabase{name: "slow", delay: 5 * time.Second}
+	fast := &fakeDatabase{name: "fast"}
+	policy := &HedgePolicy{Percentile: 0.9, InitialDelay: 20 * time.Millisecond, Window: 10}
+	hedged := NewHedgedClient(policy, newHedgeTestClients(t, slow, fast)...)
+	ctx := context.Background()
+
+	conn, err := NewConn(ctx, hedged)
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, HedgeStats{Hedged: 1, Sent: 1, Won: 1}, hedged.Stats())
+	assert.Equal(t, []string{"select 1"}, fast.queries)
+	assert.Equal(t, "slow1", string(conn.Signature()), "the Session from the other address is dropped")
+	assert.Len(t, hedged.latencies, 1, "a won hedge counts too")
+	assert.Eventually(t, func() bool {
+		slow.mu.Lock()
+		defer slow.mu.Unlock()
+		return slow.canceled == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestHedgedClientDelayHolds(t *testing.T) {
+	slow := &fakeDatabase{delay: 5 * time.Second}
+	fast := &fakeDatabase{}
+	policy := &HedgePolicy{Percentile: 0.5, InitialDelay: 20 * time.Millisecond, Window: 5}
+	hedged := NewHedgedClient(policy, newHedgeTestClients(t, slow, fast)...)
+	ctx := context.Background()
+
+	conn, err := NewConn(ctx, hedged)
+	require.NoError(t, err)
+	for range 2 * policy.Window {
+		_, err = conn.Execute(ctx, "select 1", nil)
+		require.NoError(t, err)
+	}
+	// the primary took longer than the delay every time, so
+	// winning hedges must not bring the delay down
+	assert.Equal(t, uint64(2*policy.Window), hedged.Stats().Won)
+	assert.GreaterOrEqual(t, hedged.hedgeDelay(), policy.InitialDelay)
+}
+
+func TestHedgedClientRefusesWrites(t *testing.T) {
+	primary := &fakeDatabase{delay: 50 * time.Millisecond}
+	other := &fakeDatabase{}
+	policy := &HedgePolicy{Percentile: 0.9, InitialDelay: time.Millisecond, Window: 10}
+	hedged := NewHedgedClient(policy, newHedgeTestClients(t, primary, other)...)
+	ctx := context.Background()
+
+	conn, err := NewConn(ctx, hedged)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "insert into t values (1)", nil)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "select 1 for update", nil)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "begin", nil)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, HedgeStats{}, hedged.Stats())
+	assert.Empty(t, other.queries)
+}
+
+func TestHedgedPoolClient(t *testing.T) {
+	slow := &fakeDatabase{delay: 5 * time.Second}
+	fast := &fakeDatabase{}
+	slowAddr, opts := newTestServer(t, slow)
+	fastAddr, _ := newTestServer(t, fast)
+	// both test servers trust the same certificate
+	pool := NewUnauthenticatedPool(psdbv1alpha1connect.NewDatabaseClient, opts...)
+	defer pool.Close()
+	policy := &HedgePolicy{Percentile: 0.9, InitialDelay: 20 * time.Millisecond, Window: 10}
+	hedged := NewHedgedPoolClient(policy, pool, auth.NewBasicAuth("user", "pass"), slowAddr, fastAddr)
+	ctx := context.Background()
+
+	conn, err := NewConn(ctx, hedged)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), hedged.Stats().Won)
+	assert.Equal(t, 2, pool.Len())
+}
+
+func TestHedgeDelay(t *testing.T) {
+	policy := &HedgePolicy{Percentile: 0.9, InitialDelay: time.Second, MinDelay: 2 * time.Millisecond, Window: 10}
+	h := NewHedgedClient(policy)
+	assert.Equal(t, time.Second, h.hedgeDelay())
+
+	for i := 1; i <= 10; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, 9*time.Millisecond, h.hedgeDelay())
+
+	for i := 0; i < 10; i++ {
+		h.observe(time.Microsecond)
+	}
+	assert.Equal(t, 2*time.Millisecond, h.hedgeDelay())
+}
@@ -4,8 +4,19 @@ import (
 	"context"
 
 	"connectrpc.com/connect"
+
+	"github.com/planetscale/psdb/auth"
 )
 
+// authorizationHeader is the value of the Authorization header for auth.
+func authorizationHeader(auth *auth.Authorization) string {
+	return auth.Type().String() + " " + auth.HeaderValue()
+}
+
+func newAuthInterceptor(auth *auth.Authorization) *setHeadersInterceptor {
+	return &setHeadersInterceptor{"Authorization", authorizationHeader(auth)}
+}
+
 type setHeadersInterceptor struct {
 	key, value string
 }
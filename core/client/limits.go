@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"connectrpc.com/connect"
+)
+
+var (
+	ErrResultTooLarge  = errors.New("result is larger than the maximum message size, use StreamExecute to read it in parts")
+	ErrRequestTooLarge = errors.New("request is larger than the maximum message size")
+)
+
+// WithReadMaxBytes limits the size of every message read from the server
+// to n bytes, uncompressed. The default is 100 MiB, and n <= 0 removes
+// the limit. A unary call whose response is over it fails with
+// CodeResourceExhausted, matching ErrResultTooLarge.
+func WithReadMaxBytes(n int) Option {
+	return func(c *config) {
+		c.readMaxBytes = n
+	}
+}
+
+// WithSendMaxBytes limits the size of every message sent to the server
+// to n bytes, uncompressed. The default is 100 MiB, and n <= 0 removes
+// the limit. Requests over it, usually from large bind variables, fail
+// before being sent, with CodeResourceExhausted matching
+// ErrRequestTooLarge.
+func WithSendMaxBytes(n int) Option {
+	return func(c *config) {
+		c.sendMaxBytes = n
+	}
+}
+
+// sizeLimitInterceptor checks the size of requests before they are
+// sent, and marks responses that were over the read limit.
+type sizeLimitInterceptor struct {
+	sendMaxBytes int
+}
+
+func newSizeLimitInterceptor(sendMaxBytes int) *sizeLimitInterceptor {
+	return &sizeLimitInterceptor{sendMaxBytes: sendMaxBytes}
+}
+
+func (i *sizeLimitInterceptor) check(msg any) error {
+	if i.sendMaxBytes <= 0 {
+		return nil
+	}
+	if size := sizeOf(msg); size > i.sendMaxBytes {
+		return connect.NewError(connect.CodeResourceExhausted,
+			fmt.Errorf("%w: %d bytes, limit is %d", ErrRequestTooLarge, size, i.sendMaxBytes))
+	}
+	return nil
+}
+
+func (i *sizeLimitInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		if err := i.check(req.Any()); err != nil {
+			return nil, err
+		}
+		res, err := next(ctx, req)
+		// the server's own errors come over the wire, so this one is
+		// from the client, and the request was already checked above
+		if connect.CodeOf(err) == connect.CodeResourceExhausted && !connect.IsWireError(err) {
+			return nil, connect.NewError(connect.CodeResourceExhausted, fmt.Errorf("%w: %w", ErrResultTooLarge, err))
+		}
+		return res, err
+	}
+}
+
+func (i *sizeLimitInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		return &sizeLimitStreamConn{StreamingClientConn: next(ctx, spec), interceptor: i}
+	}
+}
+
+func (*sizeLimitInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+type sizeLimitStreamConn struct {
+	connect.StreamingClientConn
+	interceptor *sizeLimitInterceptor
+}
+
+func (c *sizeLimitStreamConn) Send(msg any) error {
+	if err := c.interceptor.check(msg); err != nil {
+		return err
+	}
+	return c.StreamingClientConn.Send(msg)
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+func TestSendMaxBytes(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	ctx := context.Background()
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), append(opts, WithSendMaxBytes(1024))...)
+	require.NoError(t, err)
+
+	big := map[string]*querypb.BindVariable{
+		"blob": {Type: querypb.Type_VARBINARY, Value: []byte(strings.Repeat("x", 2048))},
+	}
+	_, err = conn.Execute(ctx, "insert into t values (:blob)", big)
+	assert.ErrorIs(t, err, ErrRequestTooLarge)
+	assert.Equal(t, connect.CodeResourceExhausted, connect.CodeOf(err))
+
+	_, err = conn.StreamExecute(ctx, "insert into t values (:blob)", big)
+	assert.ErrorIs(t, err, ErrRequestTooLarge)
+
+	// nothing reached the server
+	assert.Equal(t, 0, db.attemptsOf(psdbv1alpha1connect.DatabaseExecuteProcedure))
+	assert.Equal(t, 0, db.attemptsOf(psdbv1alpha1connect.DatabaseStreamExecuteProcedure))
+
+	_, err = conn.Execute(ctx, "select 1", nil)
+	assert.NoError(t, err)
+}
+
+func TestReadMaxBytes(t *testing.T) {
+	addr, opts := newTestServer(t, &fakeDatabase{})
+	ctx := context.Background()
+	client := New(addr, psdbv1alpha1connect.NewDatabaseClient, auth.NewBasicAuth("user", "pass"), append(opts, WithReadMaxBytes(8))...)
+
+	_, err := client.Execute(ctx, connect.NewRequest(&psdbv1alpha1.ExecuteRequest{Query: "select 1"}))
+	assert.ErrorIs(t, err, ErrResultTooLarge)
+	assert.Equal(t, connect.CodeResourceExhausted, connect.CodeOf(err))
+	assert.ErrorContains(t, err, "use StreamExecute")
+
+	// streamed messages are over the limit one at a time
+	stream, err := client.StreamExecute(ctx, connect.NewRequest(&psdbv1alpha1.ExecuteRequest{Query: "select 1"}))
+	require.NoError(t, err)
+	assert.False(t, stream.Receive())
+	assert.Equal(t, connect.CodeResourceExhausted, connect.CodeOf(stream.Err()))
+	assert.NotErrorIs(t, stream.Err(), ErrResultTooLarge)
+
+	unlimited := New(addr, psdbv1alpha1connect.NewDatabaseClient, auth.NewBasicAuth("user", "pass"), append(opts, WithReadMaxBytes(0))...)
+	_, err = unlimited.Execute(ctx, connect.NewRequest(&psdbv1alpha1.ExecuteRequest{Query: "select 1"}))
+	assert.NoError(t, err)
+}
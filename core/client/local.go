@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Address schemes for servers without TLS, typically a local sidecar that
+// handles TLS upstream. Both are spoken over unencrypted HTTP/2 (h2c), so
+// streaming keeps working:
+//
+//	unix:///run/psdb.sock
+//	h2c://127.0.0.1:8080
+//
+// Any other address is dialed over TLS.
+const (
+	SchemeUnix = "unix://"
+	SchemeH2C  = "h2c://"
+)
+
+// unixHostSuffix marks the hosts standing for a Unix socket, whose path is
+// hex encoded in front of it. Every socket needs its own host, as the
+// transport keeps connections per host.
+const unixHostSuffix = ".unix.invalid"
+
+// baseURL returns the URL clients for addr are built with.
+func baseURL(addr string) string {
+	switch {
+	case strings.HasPrefix(addr, SchemeUnix):
+		path := strings.TrimPrefix(addr, SchemeUnix)
+		return "http://" + hex.EncodeToString([]byte(path)) + unixHostSuffix
+	case strings.HasPrefix(addr, SchemeH2C):
+		return "http://" + strings.TrimPrefix(addr, SchemeH2C)
+	}
+	return "https://" + addr
+}
+
+// socketPath returns the Unix socket a host from baseURL stands for.
+func socketPath(host string) (string, bool) {
+	encoded, ok := strings.CutSuffix(host, unixHostSuffix)
+	if !ok {
+		return "", false
+	}
+	path, err := hex.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(path), true
+}
+
+// localTransport sends plain HTTP requests, from the unix and h2c schemes,
+// over h2c, and everything else through remote.
+type localTransport struct {
+	remote http.RoundTripper
+	local  *http.Transport
+}
+
+// newLocalTransport builds the h2c transport from a clone of t, so it
+// shares its defaults, minus TLS and proxying.
+func newLocalTransport(remote http.RoundTripper, t *http.Transport) *localTransport {
+	local := t.Clone()
+	local.Proxy = nil
+	local.TLSClientConfig = nil
+	local.Protocols = new(http.Protocols)
+	local.Protocols.SetUnencryptedHTTP2(true)
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	local.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if path, ok := socketPath(host); ok {
+			return dialer.DialContext(ctx, "unix", path)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return &localTransport{remote: remote, local: local}
+}
+
+func (t *localTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" {
+		return t.remote.RoundTrip(req)
+	}
+	if _, ok := socketPath(req.URL.Hostname()); ok {
+		// the encoded path means nothing to the server
+		r := new(http.Request)
+		*r = *req
+		r.Host = "localhost"
+		req = r
+	}
+	return t.local.RoundTrip(req)
+}
+
+func (t *localTransport) CloseIdleConnections() {
+	if c, ok := t.remote.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+	t.local.CloseIdleConnections()
+}
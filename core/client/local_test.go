@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"connectrpc.com/connect"
+	compress "github.com/klauspost/connect-compress/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	"github.com/planetscale/psdb/core/codec"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+// newH2CTestServer serves h on ln over h2c, and records the protocol and
+// Host of every request.
+func newH2CTestServer(t *testing.T, ln net.Listener) func() (protos, hosts []string) {
+	t.Helper()
+	var (
+		mu            sync.Mutex
+		protos, hosts []string
+	)
+	path, handler := psdbv1alpha1connect.NewDatabaseHandler(&fakeDatabase{},
+		compress.WithAll(compress.LevelFastest),
+		connect.WithCodec(codec.DefaultCodec),
+	)
+	mux := http.NewServeMux()
+	mux.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		protos = append(protos, r.Proto)
+		hosts = append(hosts, r.Host)
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	srv := &http.Server{Handler: mux, Protocols: new(http.Protocols)}
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return func() ([]string, []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		return protos, hosts
+	}
+}
+
+func TestLocalTransports(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	socket := filepath.Join(t.TempDir(), "psdb.sock")
+	unix, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	cases := []struct {
+		addr string
+		ln   net.Listener
+		host string
+	}{
+		{SchemeH2C + tcp.Addr().String(), tcp, tcp.Addr().String()},
+		{SchemeUnix + socket, unix, "localhost"},
+	}
+	for _, c := range cases {
+		t.Run(c.addr, func(t *testing.T) {
+			requests := newH2CTestServer(t, c.ln)
+			ctx := context.Background()
+			conn, err := Dial(ctx, c.addr, auth.NewBasicAuth("user", "pass"))
+			require.NoError(t, err)
+			_, err = conn.Execute(ctx, "select 1", nil)
+			require.NoError(t, err)
+
+			stream, err := conn.StreamExecute(ctx, "select 1", nil)
+			require.NoError(t, err)
+			var n int
+			for stream.Receive() {
+				n++
+			}
+			require.NoError(t, stream.Err())
+			assert.Equal(t, 3, n)
+
+			protos, hosts := requests()
+			assert.Equal(t, []string{"HTTP/2.0", "HTTP/2.0", "HTTP/2.0"}, protos)
+			assert.Equal(t, []string{c.host, c.host, c.host}, hosts)
+		})
+	}
+}
+
+func TestLocalTransportsInPool(t *testing.T) {
+	socket1 := filepath.Join(t.TempDir(), "1.sock")
+	socket2 := filepath.Join(t.TempDir(), "2.sock")
+	ln1, err := net.Listen("unix", socket1)
+	require.NoError(t, err)
+	ln2, err := net.Listen("unix", socket2)
+	require.NoError(t, err)
+	requests1 := newH2CTestServer(t, ln1)
+	requests2 := newH2CTestServer(t, ln2)
+
+	p := NewUnauthenticatedPool(psdbv1alpha1connect.NewDatabaseClient)
+	defer p.Close()
+	ctx := context.Background()
+	for _, addr := range []string{SchemeUnix + socket1, SchemeUnix + socket2, SchemeUnix + socket1} {
+		_, err := NewConn(ctx, p.GetWithAuth(addr, auth.NewBasicAuth("user", "pass")))
+		require.NoError(t, err)
+	}
+	protos1, _ := requests1()
+	protos2, _ := requests2()
+	assert.Len(t, protos1, 2)
+	assert.Len(t, protos2, 1)
+}
+
+func TestBaseURL(t *testing.T) {
+	assert.Equal(t, "https://db.example.com:443", baseURL("db.example.com:443"))
+	assert.Equal(t, "http://127.0.0.1:8080", baseURL("h2c://127.0.0.1:8080"))
+	u := baseURL("unix:///run/psdb.sock")
+	path, ok := socketPath(u[len("http://"):])
+	assert.True(t, ok)
+	assert.Equal(t, "/run/psdb.sock", path)
+}
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+const defaultMaxLoggedQueryLength = 1024
+
+// LogConfig controls what the logging interceptor writes. The zero value
+// logs normalized queries, truncated to 1 KiB, and no bind variable values.
+// Headers and Sessions are never logged, so neither are credentials and
+// session signatures.
+type LogConfig struct {
+	// Level is the level of calls that succeed. Failed calls,
+	// and responses carrying an RPCError, are logged at LevelError.
+	Level slog.Level
+	// MaxQueryLength truncates logged queries, in bytes.
+	// Zero means 1 KiB, and a negative value doesn't log queries.
+	MaxQueryLength int
+	// RawQueries logs queries as sent, literals included,
+	// instead of normalized.
+	RawQueries bool
+	// BindVariableValues logs the value of bind variables, instead of
+	// only their type.
+	BindVariableValues bool
+}
+
+// WithLogger logs every RPC made by the client to logger.
+func WithLogger(logger *slog.Logger, cfg LogConfig) Option {
+	return func(c *config) {
+		c.interceptors = append(c.interceptors, newLoggingInterceptor(logger, cfg))
+	}
+}
+
+type loggingInterceptor struct {
+	logger *slog.Logger
+	cfg    LogConfig
+}
+
+func newLoggingInterceptor(logger *slog.Logger, cfg LogConfig) *loggingInterceptor {
+	if cfg.MaxQueryLength == 0 {
+		cfg.MaxQueryLength = defaultMaxLoggedQueryLength
+	}
+	return &loggingInterceptor{logger: logger, cfg: cfg}
+}
+
+func (i *loggingInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		start := time.Now()
+		res, err := next(ctx, req)
+		var msg any
+		if err == nil {
+			msg = res.Any()
+		}
+		i.log(ctx, req.Spec().Procedure, req.Peer().Addr, req.Any(), msg, time.Since(start), err)
+		return res, err
+	}
+}
+
+func (i *loggingInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		return &loggingStreamConn{
+			StreamingClientConn: next(ctx, spec),
+			interceptor:         i,
+			ctx:                 ctx,
+			start:               time.Now(),
+		}
+	}
+}
+
+func (*loggingInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+func (i *loggingInterceptor) log(
+	ctx context.Context,
+	procedure, addr string,
+	req, res any,
+	duration time.Duration,
+	err error,
+) {
+	level := i.cfg.Level
+	attrs := []slog.Attr{
+		slog.String("procedure", procedure),
+		slog.String("addr", addr),
+		slog.Duration("duration", duration),
+	}
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs,
+			slog.String("status", connect.CodeOf(err).String()),
+			slog.String("error", i.redact(err.Error())),
+		)
+	} else {
+		attrs = append(attrs, slog.String("status", "ok"))
+	}
+	if rpcErr := rpcErrorOf(res); rpcErr != nil {
+		level = slog.LevelError
+		attrs = append(attrs,
+			slog.String("vtrpc_code", rpcErr.GetCode().String()),
+			slog.String("vtrpc_error", i.redact(rpcErr.GetMessage())),
+		)
+	}
+	if !i.logger.Enabled(ctx, level) {
+		return
+	}
+	if query := i.query(req); query != "" {
+		attrs = append(attrs, slog.String("query", query))
+	}
+	if bindVars := i.bindVars(req); len(bindVars) > 0 {
+		attrs = append(attrs, slog.Attr{Key: "bind_vars", Value: slog.GroupValue(bindVars...)})
+	}
+	i.logger.LogAttrs(ctx, level, "psdb rpc", attrs...)
+}
+
+// redact hides the statements and values quoted in an error message,
+// as they are in the query and bind_vars attributes.
+func (i *loggingInterceptor) redact(msg string) string {
+	return redactErrorMessage(msg, i.cfg.RawQueries, i.cfg.BindVariableValues)
+}
+
+func (i *loggingInterceptor) query(msg any) string {
+	query := queryOf(msg)
+	if query == "" || i.cfg.MaxQueryLength < 0 {
+		return ""
+	}
+	if !i.cfg.RawQueries {
+		query = normalizeQuery(query)
+	}
+	if len(query) > i.cfg.MaxQueryLength {
+		query = query[:i.cfg.MaxQueryLength] + "..."
+	}
+	return query
+}
+
+func (i *loggingInterceptor) bindVars(msg any) []slog.Attr {
+	bindVars := bindVarsOf(msg)
+	names := make([]string, 0, len(bindVars))
+	for name := range bindVars {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	attrs := make([]slog.Attr, 0, len(names))
+	for _, name := range names {
+		bv := bindVars[name]
+		if i.cfg.BindVariableValues {
+			attrs = append(attrs, slog.String(name, bv.GetType().String()+"("+string(bv.GetValue())+")"))
+		} else {
+			attrs = append(attrs, slog.String(name, bv.GetType().String()))
+		}
+	}
+	return attrs
+}
+
+// loggingStreamConn logs a streaming call once its response ends.
+type loggingStreamConn struct {
+	connect.StreamingClientConn
+	interceptor *loggingInterceptor
+	ctx         context.Context
+	start       time.Time
+
+	once     sync.Once
+	req, res any
+}
+
+func (c *loggingStreamConn) Send(msg any) error {
+	if c.req == nil {
+		c.req = msg
+	}
+	err := c.StreamingClientConn.Send(msg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.end(err)
+	}
+	return err
+}
+
+func (c *loggingStreamConn) Receive(msg any) error {
+	err := c.StreamingClientConn.Receive(msg)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.end(nil)
+	case err != nil:
+		c.end(err)
+	default:
+		// only the message with an RPCError, which ends
+		// the stream, matters for the log
+		if rpcErrorOf(msg) != nil {
+			c.res = msg
+		}
+	}
+	return err
+}
+
+func (c *loggingStreamConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	c.end(nil)
+	return err
+}
+
+func (c *loggingStreamConn) end(err error) {
+	c.once.Do(func() {
+		c.interceptor.log(c.ctx, c.Spec().Procedure, c.Peer().Addr, c.req, c.res, time.Since(c.start), err)
+	})
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	"github.com/planetscale/psdb/core/bindvars"
+)
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var line map[string]any
+		require.NoError(t, dec.Decode(&line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLogging(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	a := auth.NewBasicAuth("user", "secret")
+	ctx := context.Background()
+
+	conn, err := Dial(ctx, addr, a, append(opts, WithLogger(logger, LogConfig{}))...)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "select * from t where password = 'hunter2' and id = :v1", map[string]*querypb.BindVariable{
+		"v1": bindvars.Int64(987654321),
+	})
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "duplicate", nil)
+	require.Error(t, err)
+	_, err = conn.Execute(ctx, "error", nil)
+	require.Error(t, err)
+	stream, err := conn.StreamExecute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	for stream.Receive() {
+	}
+	require.NoError(t, stream.Err())
+
+	out := buf.String()
+	assert.NotContains(t, out, "hunter2")
+	assert.NotContains(t, out, "987654321")
+	assert.NotContains(t, out, a.HeaderValue())
+	assert.NotContains(t, out, "signature")
+	assert.NotContains(t, out, "alice")
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 5)
+
+	assert.Equal(t, "/psdb.v1alpha1.Database/CreateSession", lines[0]["procedure"])
+	assert.Equal(t, "INFO", lines[0]["level"])
+	assert.Equal(t, "ok", lines[0]["status"])
+	assert.Equal(t, addr, lines[0]["addr"])
+
+	assert.Equal(t, "select * from t where password = ? and id = :v1", lines[1]["query"])
+	assert.Equal(t, map[string]any{"v1": "INT64"}, lines[1]["bind_vars"])
+
+	assert.Equal(t, "ERROR", lines[2]["level"])
+	assert.Equal(t, "ALREADY_EXISTS", lines[2]["vtrpc_code"])
+	assert.Contains(t, lines[2]["vtrpc_error"], "BindVars: {[redacted]}")
+
+	assert.Equal(t, "ERROR", lines[3]["level"])
+	assert.Contains(t, lines[3]["error"], `Sql: "insert into users(email) values (?)"`)
+
+	assert.Equal(t, "/psdb.v1alpha1.Database/StreamExecute", lines[4]["procedure"])
+	assert.Equal(t, "select ?", lines[4]["query"])
+}
+
+func TestLoggingRaw(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	ctx := context.Background()
+
+	cfg := LogConfig{RawQueries: true, BindVariableValues: true, MaxQueryLength: 20}
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), append(opts, WithLogger(logger, cfg))...)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "select * from t where id = :v1", map[string]*querypb.BindVariable{
+		"v1": bindvars.Int64(42),
+	})
+	require.NoError(t, err)
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "select * from t wher...", lines[1]["query"])
+	assert.Equal(t, map[string]any{"v1": "INT64(42)"}, lines[1]["bind_vars"])
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+	vtrpcpb "github.com/planetscale/vitess-types/gen/vitess/vtrpc/v22"
+
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+)
+
+// The helpers below read common fields out of any Database or Connect
+// message, for interceptors that only see them as an any.
+
+func queryOf(msg any) string {
+	if m, ok := msg.(interface{ GetQuery() string }); ok {
+		return m.GetQuery()
+	}
+	return ""
+}
+
+func rpcErrorOf(msg any) *vtrpcpb.RPCError {
+	if m, ok := msg.(interface{ GetError() *vtrpcpb.RPCError }); ok {
+		return m.GetError()
+	}
+	return nil
+}
+
+// rowsOf returns the number of rows returned and affected by msg.
+func rowsOf(msg any) (rows, affected int64) {
+	switch m := msg.(type) {
+	case interface{ GetResult() *querypb.QueryResult }:
+		r := m.GetResult()
+		return int64(len(r.GetRows())), int64(r.GetRowsAffected())
+	case interface{ GetResult() []*querypb.QueryResult }:
+		for _, r := range m.GetResult() {
+			rows += int64(len(r.GetRows()))
+			affected += int64(r.GetRowsAffected())
+		}
+	}
+	return rows, affected
+}
+
+// timingOf returns the server reported time spent on msg, in seconds.
+func timingOf(msg any) (float64, bool) {
+	if m, ok := msg.(interface{ GetTiming() float64 }); ok && m.GetTiming() > 0 {
+		return m.GetTiming(), true
+	}
+	return 0, false
+}
+
+func sizeOf(msg any) int {
+	if m, ok := msg.(interface{ SizeVT() int }); ok {
+		return m.SizeVT()
+	}
+	return 0
+}
+
+func bindVarsOf(msg any) map[string]*querypb.BindVariable {
+	if m, ok := msg.(interface {
+		GetBindVariables() map[string]*querypb.BindVariable
+	}); ok {
+		return m.GetBindVariables()
+	}
+	return nil
+}
+
+func sessionOf(msg any) *psdbv1alpha1.Session {
+	if m, ok := msg.(interface {
+		GetSession() *psdbv1alpha1.Session
+	}); ok {
+		return m.GetSession()
+	}
+	return nil
+}
+
+func signatureOf(msg any) []byte {
+	return sessionOf(msg).GetSignature()
+}
@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+	vtrpcpb "github.com/planetscale/vitess-types/gen/vitess/vtrpc/v22"
+)
+
+// Recorder receives metrics for every RPC made by a client.
+// It must be safe for concurrent use.
+type Recorder interface {
+	// StreamStarted and StreamEnded bracket every streaming call,
+	// so the number of streams in flight can be tracked.
+	StreamStarted(procedure string)
+	StreamEnded(procedure string)
+	// RecordRPC is called once for every call, after it has finished.
+	RecordRPC(stats RPCStats)
+}
+
+// RPCStats describes a finished call.
+type RPCStats struct {
+	Procedure string
+	// Code is "ok", or the connect.Code the call failed with.
+	Code string
+	// VTRPCCode is the code of an RPCError in the response, or OK.
+	VTRPCCode vtrpcpb.Code
+	// Latency is measured by the client, from the start of the call to
+	// the end of the response. ServerTiming is the time reported by the
+	// server in the response, or zero if it reported none. The difference
+	// is spent on the network and in the proxies along the way.
+	Latency      time.Duration
+	ServerTiming time.Duration
+
+	RequestMessages  int
+	ResponseMessages int
+	// RequestBytes and ResponseBytes are the uncompressed sizes of the
+	// messages, WireRequestBytes and WireResponseBytes the sizes of
+	// the HTTP bodies, after compression and framing.
+	RequestBytes      int64
+	ResponseBytes     int64
+	WireRequestBytes  int64
+	WireResponseBytes int64
+}
+
+// WithMetrics reports every RPC made by the client to recorder.
+func WithMetrics(recorder Recorder) Option {
+	return func(c *config) {
+		c.interceptors = append(c.interceptors, newMetricsInterceptor(recorder))
+		c.countWireBytes = true
+	}
+}
+
+type metricsInterceptor struct {
+	recorder Recorder
+}
+
+func newMetricsInterceptor(recorder Recorder) *metricsInterceptor {
+	return &metricsInterceptor{recorder: recorder}
+}
+
+func (i *metricsInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		wire := &wireCounter{}
+		ctx = context.WithValue(ctx, wireCounterKey{}, wire)
+		stats := RPCStats{
+			Procedure:       req.Spec().Procedure,
+			RequestMessages: 1,
+			RequestBytes:    int64(sizeOf(req.Any())),
+		}
+		start := time.Now()
+
+		res, err := next(ctx, req)
+		stats.Latency = time.Since(start)
+		if err == nil {
+			msg := res.Any()
+			stats.ResponseMessages = 1
+			stats.ResponseBytes = int64(sizeOf(msg))
+			setResponseStats(&stats, msg)
+		}
+		finishStats(&stats, wire, err)
+		i.recorder.RecordRPC(stats)
+		return res, err
+	}
+}
+
+func (i *metricsInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		wire := &wireCounter{}
+		ctx = context.WithValue(ctx, wireCounterKey{}, wire)
+		i.recorder.StreamStarted(spec.Procedure)
+		return &metricsStreamConn{
+			StreamingClientConn: next(ctx, spec),
+			recorder:            i.recorder,
+			wire:                wire,
+			start:               time.Now(),
+			stats:               RPCStats{Procedure: spec.Procedure},
+		}
+	}
+}
+
+func (*metricsInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+type metricsStreamConn struct {
+	connect.StreamingClientConn
+	recorder Recorder
+	wire     *wireCounter
+	start    time.Time
+
+	once  sync.Once
+	stats RPCStats
+}
+
+func (c *metricsStreamConn) Send(msg any) error {
+	err := c.StreamingClientConn.Send(msg)
+	if err == nil {
+		c.stats.RequestMessages++
+		c.stats.RequestBytes += int64(sizeOf(msg))
+	} else if !errors.Is(err, io.EOF) {
+		c.end(err)
+	}
+	return err
+}
+
+func (c *metricsStreamConn) Receive(msg any) error {
+	err := c.StreamingClientConn.Receive(msg)
+	if errors.Is(err, io.EOF) {
+		c.end(nil)
+		return err
+	}
+	if err != nil {
+		c.end(err)
+		return err
+	}
+	c.stats.ResponseMessages++
+	c.stats.ResponseBytes += int64(sizeOf(msg))
+	setResponseStats(&c.stats, msg)
+	return nil
+}
+
+func (c *metricsStreamConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	c.end(nil)
+	return err
+}
+
+func (c *metricsStreamConn) end(err error) {
+	c.once.Do(func() {
+		c.stats.Latency = time.Since(c.start)
+		finishStats(&c.stats, c.wire, err)
+		c.recorder.StreamEnded(c.stats.Procedure)
+		c.recorder.RecordRPC(c.stats)
+	})
+}
+
+func setResponseStats(stats *RPCStats, msg any) {
+	if timing, ok := timingOf(msg); ok {
+		stats.ServerTiming = time.Duration(timing * float64(time.Second))
+	}
+	if rpcErr := rpcErrorOf(msg); rpcErr != nil {
+		stats.VTRPCCode = rpcErr.GetCode()
+	}
+}
+
+func finishStats(stats *RPCStats, wire *wireCounter, err error) {
+	stats.Code = "ok"
+	if err != nil {
+		stats.Code = connect.CodeOf(err).String()
+	}
+	stats.WireRequestBytes = wire.sent.Load()
+	stats.WireResponseBytes = wire.received.Load()
+}
+
+// wireCounter counts the bytes of the HTTP bodies of a call. The metrics
+// interceptor puts one in the context, for countingHTTPClient to find.
+type wireCounter struct {
+	sent, received atomic.Int64
+}
+
+type wireCounterKey struct{}
+
+// countingHTTPClient counts the body bytes of calls carrying a wireCounter.
+type countingHTTPClient struct {
+	connect.HTTPClient
+}
+
+func (c *countingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	wire, ok := req.Context().Value(wireCounterKey{}).(*wireCounter)
+	if !ok {
+		return c.HTTPClient.Do(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		counted := *req
+		counted.Body = &countingReader{req.Body, &wire.sent}
+		if getBody := req.GetBody; getBody != nil {
+			counted.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				return &countingReader{body, &wire.sent}, nil
+			}
+		}
+		req = &counted
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = &countingReader{res.Body, &wire.received}
+	return res, nil
+}
+
+func (c *countingHTTPClient) CloseIdleConnections() {
+	if t, ok := c.HTTPClient.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
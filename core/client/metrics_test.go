@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	vtrpcpb "github.com/planetscale/vitess-types/gen/vitess/vtrpc/v22"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+type memoryRecorder struct {
+	mu       sync.Mutex
+	inFlight int
+	maxIn    int
+	stats    []RPCStats
+}
+
+func (r *memoryRecorder) StreamStarted(string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight++
+	r.maxIn = max(r.maxIn, r.inFlight)
+}
+
+func (r *memoryRecorder) StreamEnded(string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight--
+}
+
+func (r *memoryRecorder) RecordRPC(stats RPCStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats = append(r.stats, stats)
+}
+
+func TestMetrics(t *testing.T) {
+	db := &fakeDatabase{failures: map[string]int{psdbv1alpha1connect.DatabasePrepareProcedure: 1}}
+	addr, opts := newTestServer(t, db)
+	recorder := &memoryRecorder{}
+	ctx := context.Background()
+
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), append(opts, WithMetrics(recorder))...)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "duplicate", nil)
+	require.Error(t, err)
+	_, err = conn.Prepare(ctx, "select 1", nil)
+	require.Error(t, err)
+	stream, err := conn.StreamExecute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	for stream.Receive() {
+	}
+	require.NoError(t, stream.Err())
+
+	require.Len(t, recorder.stats, 5)
+	assert.Equal(t, 1, recorder.maxIn)
+	assert.Equal(t, 0, recorder.inFlight)
+
+	execute := recorder.stats[1]
+	assert.Equal(t, psdbv1alpha1connect.DatabaseExecuteProcedure, execute.Procedure)
+	assert.Equal(t, "ok", execute.Code)
+	assert.Equal(t, vtrpcpb.Code_OK, execute.VTRPCCode)
+	assert.Equal(t, time.Millisecond, execute.ServerTiming)
+	assert.Positive(t, execute.Latency)
+	assert.Equal(t, 1, execute.RequestMessages)
+	assert.Equal(t, 1, execute.ResponseMessages)
+	assert.Positive(t, execute.RequestBytes)
+	assert.Positive(t, execute.ResponseBytes)
+	assert.Positive(t, execute.WireRequestBytes)
+	assert.Positive(t, execute.WireResponseBytes)
+
+	assert.Equal(t, vtrpcpb.Code_ALREADY_EXISTS, recorder.stats[2].VTRPCCode)
+	assert.Equal(t, connect.CodeUnavailable.String(), recorder.stats[3].Code)
+
+	streaming := recorder.stats[4]
+	assert.Equal(t, psdbv1alpha1connect.DatabaseStreamExecuteProcedure, streaming.Procedure)
+	assert.Equal(t, "ok", streaming.Code)
+	assert.Equal(t, 3, streaming.ResponseMessages)
+	assert.Zero(t, streaming.ServerTiming)
+	assert.Positive(t, streaming.WireResponseBytes)
+}
+
+func TestMetricsPool(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	recorder := &memoryRecorder{}
+	pool := NewUnauthenticatedPool(psdbv1alpha1connect.NewDatabaseClient, append(opts, WithMetrics(recorder))...)
+	defer pool.Close()
+
+	_, err := pool.Get(addr).CreateSession(context.Background(), connect.NewRequest(&psdbv1alpha1.CreateSessionRequest{}))
+	require.NoError(t, err)
+	require.Len(t, recorder.stats, 1)
+	assert.Equal(t, psdbv1alpha1connect.DatabaseCreateSessionProcedure, recorder.stats[0].Procedure)
+}
+
+func TestPrometheusRecorder(t *testing.T) {
+	r := NewPrometheusRecorder()
+	r.StreamStarted("/p/Stream")
+	r.RecordRPC(RPCStats{
+		Procedure:     "/p/Execute",
+		Code:          "ok",
+		VTRPCCode:     vtrpcpb.Code_ALREADY_EXISTS,
+		Latency:       3 * time.Millisecond,
+		ServerTiming:  time.Millisecond,
+		RequestBytes:  100,
+		ResponseBytes: 2000,
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		`# TYPE psdb_client_calls_total counter`,
+		`psdb_client_calls_total{procedure="/p/Execute",code="ok"} 1`,
+		`psdb_client_vtrpc_errors_total{procedure="/p/Execute",code="ALREADY_EXISTS"} 1`,
+		`psdb_client_streams_in_flight{procedure="/p/Stream"} 1`,
+		`psdb_client_latency_seconds_bucket{procedure="/p/Execute",le="0.001"} 0`,
+		`psdb_client_latency_seconds_bucket{procedure="/p/Execute",le="0.005"} 1`,
+		`psdb_client_latency_seconds_bucket{procedure="/p/Execute",le="+Inf"} 1`,
+		`psdb_client_latency_seconds_count{procedure="/p/Execute"} 1`,
+		`psdb_client_server_timing_seconds_sum{procedure="/p/Execute"} 0.001`,
+		`psdb_client_response_bytes_sum{procedure="/p/Execute"} 2000`,
+	} {
+		assert.Contains(t, strings.Split(body, "\n"), line)
+	}
+}
+
+func TestExpvarRecorder(t *testing.T) {
+	// expvar names can't be reused, even across -count runs
+	name := "psdb_test_metrics_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	r := NewExpvarRecorder(name)
+	r.RecordRPC(RPCStats{Procedure: "/p/Execute", Code: "ok", Latency: 3 * time.Millisecond})
+
+	var got map[string]expvarProcedure
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get(name).String()), &got))
+	assert.Equal(t, uint64(1), got["/p/Execute"].Codes["ok"])
+	assert.Equal(t, uint64(1), got["/p/Execute"].Latency.Count)
+	assert.Equal(t, uint64(1), got["/p/Execute"].Latency.Buckets["0.005"])
+	assert.Equal(t, uint64(0), got["/p/Execute"].Latency.Buckets["0.001"])
+}
@@ -0,0 +1,291 @@
+package client
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// LoadClientCertificate loads a PEM encoded client certificate and key.
+func LoadClientCertificate(certFile, keyFile string) (tls.Certificate, error) {
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// TLSConfigWithClientCertificate returns a copy of cfg presenting cert
+// to servers that ask for a client certificate. A nil cfg starts from
+// DefaultTLSConfig.
+func TLSConfigWithClientCertificate(cfg *tls.Config, cert tls.Certificate) *tls.Config {
+	if cfg == nil {
+		cfg = DefaultTLSConfig()
+	}
+	cfg = cfg.Clone()
+	cfg.Certificates = []tls.Certificate{cert}
+	return cfg
+}
+
+// fileStamp tells whether a file changed since it was last read.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampOf(path string) (fileStamp, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{fi.ModTime(), fi.Size()}, nil
+}
+
+// CertReloader holds a client certificate, and optionally root CAs, read
+// from files that are checked for changes at most once per check interval,
+// and reloaded when they change. A reload that fails, such as when only one
+// of the certificate and key has been replaced so far, keeps the previous
+// ones in use until the next check.
+type CertReloader struct {
+	certFile, keyFile, caFile string
+	interval                  time.Duration
+
+	mu        sync.RWMutex
+	checkedAt time.Time
+	stamps    [3]fileStamp
+	cert      *tls.Certificate
+	roots     *x509.CertPool
+
+	// generation counts the reloads, so transports can
+	// tell when to recycle their connections
+	generation atomic.Uint64
+}
+
+// NewCertReloader loads certFile and keyFile, and caFile unless empty,
+// failing if any of them can't be loaded.
+func NewCertReloader(certFile, keyFile, caFile string, checkInterval time.Duration) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		interval: checkInterval,
+	}
+	if err := r.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) files() []string {
+	if r.caFile == "" {
+		return []string{r.certFile, r.keyFile}
+	}
+	return []string{r.certFile, r.keyFile, r.caFile}
+}
+
+// check reloads the files if they changed, at most once per interval.
+func (r *CertReloader) check() {
+	now := time.Now()
+	r.mu.RLock()
+	due := now.Sub(r.checkedAt) >= r.interval
+	r.mu.RUnlock()
+	if due {
+		_ = r.reload(now)
+	}
+}
+
+func (r *CertReloader) reload(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkedAt = now
+
+	var stamps [3]fileStamp
+	for i, path := range r.files() {
+		stamp, err := stampOf(path)
+		if err != nil {
+			return err
+		}
+		stamps[i] = stamp
+	}
+	if r.cert != nil && stamps == r.stamps {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	var roots *x509.CertPool
+	if r.caFile != "" {
+		b, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(b) {
+			return errors.New("no certificates found")
+		}
+	}
+	r.cert, r.roots, r.stamps = &cert, roots, stamps
+	r.generation.Add(1)
+	return nil
+}
+
+// GetClientCertificate is a tls.Config.GetClientCertificate returning
+// the current certificate.
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.check()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// RootCAs returns the current root CAs, or nil without a CA file.
+func (r *CertReloader) RootCAs() *x509.CertPool {
+	r.check()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.roots
+}
+
+// TLSConfig returns a copy of DefaultTLSConfig using the current client
+// certificate, and the current root CAs when there is a CA file. Since a
+// tls.Config can't change its RootCAs once in use, the chain is then
+// verified by VerifyConnection instead, for the ServerName of the returned
+// config, or else the name the server was dialed by. An IP address isn't
+// sent as a name, so set ServerName to the address to dial one. Pinned
+// keys can't be checked on such connections, see WithPinnedKeys.
+func (r *CertReloader) TLSConfig() *tls.Config {
+	cfg := DefaultTLSConfig().Clone()
+	cfg.GetClientCertificate = r.GetClientCertificate
+	if r.caFile != "" {
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return r.verifyConnection(cs, cmp.Or(cfg.ServerName, cs.ServerName))
+		}
+	}
+	return cfg
+}
+
+// transportTLSConfig is like TLSConfig, but has crypto/tls verify servers
+// with the root CAs of the moment, for a transport that is rebuilt when
+// the files are reloaded.
+func (r *CertReloader) transportTLSConfig() *tls.Config {
+	cfg := DefaultTLSConfig().Clone()
+	cfg.GetClientCertificate = r.GetClientCertificate
+	cfg.RootCAs = r.RootCAs()
+	return cfg
+}
+
+func (r *CertReloader) verifyConnection(cs tls.ConnectionState, serverName string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+	if serverName == "" {
+		// Verify would skip the name check altogether
+		return errors.New("no server name to verify the certificate for, set ServerName")
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         r.RootCAs(),
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// WithCertReloader authenticates with the client certificate of r. Unless
+// WithTLSConfig is given too, it also verifies servers with the root CAs
+// of r. The default transport moves new calls to new connections when the
+// files are reloaded, while calls in progress finish on the old ones, with
+// the previous certificate, however long they take, as a long StreamExecute
+// or Sync can. With WithHTTPClient, only its idle connections are closed.
+func WithCertReloader(r *CertReloader) Option {
+	return func(c *config) {
+		c.certReloader = r
+	}
+}
+
+// recyclingTransport replaces its http.Transport with a fresh clone, with
+// a fresh tls.Config, whenever the CertReloader reloads, so no call goes
+// out on a connection that was set up with the previous certificate or
+// root CAs.
+type recyclingTransport struct {
+	reloader  *CertReloader
+	tlsConfig func() *tls.Config
+
+	mu         sync.Mutex
+	transport  atomic.Pointer[http.Transport]
+	generation atomic.Uint64
+}
+
+func newRecyclingTransport(t *http.Transport, reloader *CertReloader, tlsConfig func() *tls.Config) *recyclingTransport {
+	rt := &recyclingTransport{reloader: reloader, tlsConfig: tlsConfig}
+	rt.transport.Store(t)
+	rt.generation.Store(reloader.generation.Load())
+	return rt
+}
+
+func (rt *recyclingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.reloader.check()
+	if gen := rt.reloader.generation.Load(); gen != rt.generation.Load() {
+		rt.recycle(gen)
+	}
+	return rt.transport.Load().RoundTrip(req)
+}
+
+func (rt *recyclingTransport) recycle(gen uint64) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.generation.Load() == gen {
+		return
+	}
+	old := rt.transport.Load()
+	t := old.Clone()
+	t.TLSClientConfig = rt.tlsConfig()
+	rt.transport.Store(t)
+	rt.generation.Store(gen)
+	// connections busy right now are left to the idle timeout of the old
+	// transport once their calls finish
+	old.CloseIdleConnections()
+}
+
+func (rt *recyclingTransport) CloseIdleConnections() {
+	rt.transport.Load().CloseIdleConnections()
+}
+
+// reloadingHTTPClient closes the idle connections of a user supplied
+// HTTPClient when the CertReloader reloads.
+type reloadingHTTPClient struct {
+	connect.HTTPClient
+	reloader   *CertReloader
+	generation atomic.Uint64
+}
+
+func newReloadingHTTPClient(client connect.HTTPClient, reloader *CertReloader) *reloadingHTTPClient {
+	c := &reloadingHTTPClient{HTTPClient: client, reloader: reloader}
+	c.generation.Store(reloader.generation.Load())
+	return c
+}
+
+func (c *reloadingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.reloader.check()
+	gen := c.reloader.generation.Load()
+	if old := c.generation.Swap(gen); old != gen {
+		c.CloseIdleConnections()
+	}
+	return c.HTTPClient.Do(req)
+}
+
+func (c *reloadingHTTPClient) CloseIdleConnections() {
+	if t, ok := c.HTTPClient.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	compress "github.com/klauspost/connect-compress/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	"github.com/planetscale/psdb/core/codec"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM encoded client certificate and key for cn.
+func (ca *testCA) issue(t *testing.T, cn string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// issueServer returns a server certificate for ips.
+func (ca *testCA) issueServer(t *testing.T, ips ...net.IP) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func writeFile(t *testing.T, path string, b []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	cert1, key1 := ca.issue(t, "client-1")
+	writeFile(t, certFile, cert1)
+	writeFile(t, keyFile, key1)
+
+	r, err := NewCertReloader(certFile, keyFile, "", 0)
+	require.NoError(t, err)
+	first, err := r.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.Nil(t, r.RootCAs())
+
+	// a certificate without its key yet keeps the previous pair
+	cert2, key2 := ca.issue(t, "client-2-with-a-longer-name")
+	writeFile(t, certFile, cert2)
+	got, err := r.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.Same(t, first, got)
+	assert.Equal(t, uint64(1), r.generation.Load())
+
+	writeFile(t, keyFile, key2)
+	got, err = r.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.NotSame(t, first, got)
+	assert.Equal(t, uint64(2), r.generation.Load())
+
+	_, err = NewCertReloader(filepath.Join(dir, "missing.crt"), keyFile, "", 0)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMutualTLSRotation(t *testing.T) {
+	ca := newTestCA(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	var (
+		mu    sync.Mutex
+		peers []string
+	)
+	mux := http.NewServeMux()
+	path, handler := psdbv1alpha1connect.NewDatabaseHandler(&fakeDatabase{},
+		compress.WithAll(compress.LevelFastest),
+		connect.WithCodec(codec.DefaultCodec),
+	)
+	mux.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		peers = append(peers, r.TLS.PeerCertificates[0].Subject.CommonName)
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	srv := httptest.NewUnstartedServer(mux)
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"), filepath.Join(dir, "ca.crt")
+	cert1, key1 := ca.issue(t, "client-1")
+	writeFile(t, certFile, cert1)
+	writeFile(t, keyFile, key1)
+	writeFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	r, err := NewCertReloader(certFile, keyFile, caFile, 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+	conn, err := Dial(ctx, srv.Listener.Addr().String(), auth.NewBasicAuth("user", "pass"), WithCertReloader(r))
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+
+	cert2, key2 := ca.issue(t, "client-2-with-a-longer-name")
+	writeFile(t, certFile, cert2)
+	writeFile(t, keyFile, key2)
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+
+	mu.Lock()
+	assert.Equal(t, []string{"client-1", "client-1", "client-2-with-a-longer-name"}, peers)
+	mu.Unlock()
+
+	// roots from the CA file are enforced
+	writeFile(t, caFile, ca.pem)
+	untrusted, err := NewCertReloader(certFile, keyFile, caFile, 0)
+	require.NoError(t, err)
+	_, err = Dial(ctx, srv.Listener.Addr().String(), auth.NewBasicAuth("user", "pass"), WithCertReloader(untrusted))
+	assert.ErrorContains(t, err, "certificate signed by unknown authority")
+}
+
+func TestCertReloaderServerName(t *testing.T) {
+	ca := newTestCA(t)
+	newServer := func(ip string) string {
+		srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{ca.issueServer(t, net.ParseIP(ip))}}
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		return srv.Listener.Addr().String()
+	}
+	good, bad := newServer("127.0.0.1"), newServer("10.0.0.1")
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"), filepath.Join(dir, "ca.crt")
+	cert, key := ca.issue(t, "client")
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+	writeFile(t, caFile, ca.pem)
+	r, err := NewCertReloader(certFile, keyFile, caFile, 0)
+	require.NoError(t, err)
+
+	dial := func(addr string, cfg *tls.Config) error {
+		conn, err := tls.Dial("tcp", addr, cfg)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	// the IP address dialed must be in the certificate
+	cfg := r.TLSConfig()
+	cfg.ServerName = "127.0.0.1"
+	assert.NoError(t, dial(good, cfg))
+	assert.ErrorContains(t, dial(bad, cfg), "127.0.0.1")
+	assert.ErrorContains(t, dial(good, r.TLSConfig()), "no server name")
+
+	// and so it must through the default transport
+	ctx := context.Background()
+	_, err = Dial(ctx, good, auth.NewBasicAuth("user", "pass"), WithCertReloader(r))
+	assert.Equal(t, connect.CodeUnimplemented, connect.CodeOf(err), "the handshake succeeded")
+	_, err = Dial(ctx, bad, auth.NewBasicAuth("user", "pass"), WithCertReloader(r))
+	assert.ErrorContains(t, err, "127.0.0.1")
+}
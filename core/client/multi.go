@@ -0,0 +1,479 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+
+	"github.com/planetscale/psdb/auth"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+var (
+	ErrNoEndpoints    = errors.New("no endpoints")
+	ErrUnknownSession = errors.New("session unknown to this client, it may have been unused for too long")
+)
+
+//enumcheck:exhaustive
+type LoadBalancing int
+
+const (
+	// RoundRobin sends new sessions to each endpoint in turn.
+	RoundRobin LoadBalancing = iota
+	// LeastOutstanding sends new sessions to the endpoint with the
+	// fewest calls in progress.
+	LeastOutstanding
+)
+
+func (lb LoadBalancing) String() string {
+	switch lb {
+	case RoundRobin:
+		return "round-robin"
+	case LeastOutstanding:
+		return "least-outstanding"
+	}
+	return "unknown"
+}
+
+// HealthPolicy decides when an endpoint of a MultiClient is unhealthy,
+// and when it is given another chance.
+type HealthPolicy struct {
+	// Failures is the number of consecutive connection errors or
+	// CodeUnavailable after which an endpoint is unhealthy.
+	Failures int
+	// Cooldown is how long an unhealthy endpoint gets no new sessions,
+	// before real traffic is tried on it again.
+	Cooldown time.Duration
+	// ProbeInterval, if set, probes unhealthy endpoints in the background
+	// with a CreateSession, bringing them back as soon as one succeeds.
+	ProbeInterval time.Duration
+}
+
+func DefaultHealthPolicy() *HealthPolicy {
+	return &HealthPolicy{
+		Failures: 3,
+		Cooldown: 10 * time.Second,
+	}
+}
+
+// WithLoadBalancing sets how a MultiClient picks an endpoint for a new session.
+func WithLoadBalancing(lb LoadBalancing) Option {
+	return func(c *config) {
+		c.loadBalancing = lb
+	}
+}
+
+// WithHealthPolicy sets how a MultiClient tracks the health of its endpoints.
+func WithHealthPolicy(policy *HealthPolicy) Option {
+	return func(c *config) {
+		c.healthPolicy = policy
+	}
+}
+
+// EndpointStatus describes an endpoint of a MultiClient.
+type EndpointStatus struct {
+	Addr        string
+	Healthy     bool
+	Outstanding int64
+}
+
+type endpoint struct {
+	addr        string
+	client      psdbv1alpha1connect.DatabaseClient
+	outstanding atomic.Int64
+
+	mu          sync.Mutex
+	failures    int
+	unhealthyAt time.Time
+	unhealthy   bool
+}
+
+func (e *endpoint) available(now time.Time, cooldown time.Duration) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !e.unhealthy || now.Sub(e.unhealthyAt) >= cooldown
+}
+
+func (e *endpoint) record(err error, failures int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err == nil || !isBreakerFailure(err) {
+		e.failures, e.unhealthy = 0, false
+		return
+	}
+	e.failures++
+	if e.failures >= failures {
+		e.unhealthy, e.unhealthyAt = true, time.Now()
+	}
+}
+
+const (
+	// sessionRouteTTL is how long a session unused by a MultiClient
+	// is remembered, after which calls for it fail with ErrUnknownSession
+	sessionRouteTTL = time.Hour
+	minSessionSweep = 1024
+)
+
+type sessionRoute struct {
+	endpoint *endpoint
+	used     time.Time
+}
+
+// MultiClient is a DatabaseClient spread across several endpoints. New
+// sessions go to a healthy endpoint picked by the LoadBalancing, and every
+// later call for a session goes to the endpoint that created it, since
+// Session signatures are tied to the server that issued them.
+type MultiClient struct {
+	cfg    *config
+	auth   *auth.Authorization
+	health *HealthPolicy
+	next   atomic.Uint64
+
+	mu        sync.RWMutex
+	endpoints []*endpoint
+
+	// sessions maps the latest signature of each session
+	// to the endpoint that issued it
+	sessionsMu sync.Mutex
+	sessions   map[string]sessionRoute
+	sweepAt    int
+
+	watcher   *Watcher
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMultiClient builds a client for each of addrs. Options apply to
+// every endpoint, along with WithLoadBalancing and WithHealthPolicy.
+func NewMultiClient(addrs []string, auth *auth.Authorization, opts ...Option) *MultiClient {
+	cfg := configFromOptions(opts...)
+	m := &MultiClient{
+		cfg:      cfg,
+		auth:     auth,
+		health:   cfg.healthPolicy,
+		sessions: make(map[string]sessionRoute),
+		sweepAt:  minSessionSweep,
+		done:     make(chan struct{}),
+	}
+	if m.health == nil {
+		m.health = DefaultHealthPolicy()
+	}
+	m.SetAddrs(addrs)
+	if m.health.ProbeInterval > 0 {
+		go m.probe()
+	}
+	return m
+}
+
+// SetAddrs replaces the endpoints. Endpoints for addresses already known
+// are kept as they are, with their sessions and health. Sessions on a
+// removed endpoint keep going to it, until they are closed.
+func (m *MultiClient) SetAddrs(addrs []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	endpoints := make([]*endpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		i := slices.IndexFunc(m.endpoints, func(e *endpoint) bool { return e.addr == addr })
+		if i >= 0 {
+			endpoints = append(endpoints, m.endpoints[i])
+		} else {
+			endpoints = append(endpoints, m.newEndpoint(addr))
+		}
+	}
+	m.endpoints = endpoints
+}
+
+func (m *MultiClient) newEndpoint(addr string) *endpoint {
+	e := &endpoint{addr: addr}
+	cOpts := clientOptions(m.cfg, &endpointInterceptor{m, e}, m.cfg.authInterceptor(m.auth))
+	e.client = psdbv1alpha1connect.NewDatabaseClient(m.cfg.httpClient, baseURL(addr), cOpts...)
+	return e
+}
+
+// Endpoints returns the status of every current endpoint.
+func (m *MultiClient) Endpoints() []EndpointStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	statuses := make([]EndpointStatus, len(m.endpoints))
+	for i, e := range m.endpoints {
+		e.mu.Lock()
+		statuses[i] = EndpointStatus{Addr: e.addr, Healthy: !e.unhealthy, Outstanding: e.outstanding.Load()}
+		e.mu.Unlock()
+	}
+	return statuses
+}
+
+// Close stops probing endpoints, and following a Resolver.
+func (m *MultiClient) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+		if m.watcher != nil {
+			m.watcher.Close()
+		}
+	})
+}
+
+// pick chooses the endpoint for a new session. When every endpoint is
+// unhealthy, they are all tried rather than failing outright.
+func (m *MultiClient) pick() (*endpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.endpoints) == 0 {
+		return nil, connect.NewError(connect.CodeUnavailable, ErrNoEndpoints)
+	}
+	now := time.Now()
+	candidates := make([]*endpoint, 0, len(m.endpoints))
+	for _, e := range m.endpoints {
+		if e.available(now, m.health.Cooldown) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = m.endpoints
+	}
+	start := int(m.next.Add(1)-1) % len(candidates)
+	if m.cfg.loadBalancing == RoundRobin {
+		return candidates[start], nil
+	}
+	best := candidates[start]
+	for i := 1; i < len(candidates); i++ {
+		e := candidates[(start+i)%len(candidates)]
+		if e.outstanding.Load() < best.outstanding.Load() {
+			best = e
+		}
+	}
+	return best, nil
+}
+
+// route returns the endpoint that issued session, or picks one for
+// a call without a session. A session it doesn't know is an error, as
+// no other endpoint would accept its signature.
+func (m *MultiClient) route(session *psdbv1alpha1.Session) (*endpoint, error) {
+	sig := session.GetSignature()
+	if len(sig) == 0 {
+		return m.pick()
+	}
+	m.sessionsMu.Lock()
+	route, ok := m.sessions[string(sig)]
+	m.sessionsMu.Unlock()
+	if !ok {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, ErrUnknownSession)
+	}
+	return route.endpoint, nil
+}
+
+// track moves a session from its previous signature to its latest one.
+// A response without a Session, such as a failed statement, leaves the
+// session under its previous signature, which the Conn keeps sending.
+func (m *MultiClient) track(e *endpoint, prev, next []byte) {
+	if len(next) == 0 {
+		next = prev
+	}
+	if len(next) == 0 {
+		return
+	}
+	m.sessionsMu.Lock()
+	defer m.sessionsMu.Unlock()
+	if len(prev) > 0 {
+		delete(m.sessions, string(prev))
+	}
+	now := time.Now()
+	m.sessions[string(next)] = sessionRoute{e, now}
+	if len(m.sessions) >= m.sweepAt {
+		// sessions abandoned without CloseSession would otherwise
+		// stay forever, sweeping as the map doubles keeps it cheap
+		for sig, route := range m.sessions {
+			if now.Sub(route.used) > sessionRouteTTL {
+				delete(m.sessions, sig)
+			}
+		}
+		m.sweepAt = max(minSessionSweep, 2*len(m.sessions))
+	}
+}
+
+// forget drops a closed session, which is never used again.
+func (m *MultiClient) forget(sig []byte) {
+	m.sessionsMu.Lock()
+	defer m.sessionsMu.Unlock()
+	delete(m.sessions, string(sig))
+}
+
+func (m *MultiClient) probe() {
+	t := time.NewTicker(m.health.ProbeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+			m.mu.RLock()
+			endpoints := slices.Clone(m.endpoints)
+			m.mu.RUnlock()
+			for _, e := range endpoints {
+				e.mu.Lock()
+				unhealthy := e.unhealthy
+				e.mu.Unlock()
+				if !unhealthy {
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), m.health.ProbeInterval)
+				res, err := e.client.CreateSession(ctx, connect.NewRequest(&psdbv1alpha1.CreateSessionRequest{}))
+				if err == nil {
+					_, _ = e.client.CloseSession(ctx, connect.NewRequest(&psdbv1alpha1.CloseSessionRequest{
+						Session: res.Msg.GetSession(),
+					}))
+				}
+				cancel()
+			}
+		}
+	}
+}
+
+func (m *MultiClient) CreateSession(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.CreateSessionRequest],
+) (*connect.Response[psdbv1alpha1.CreateSessionResponse], error) {
+	e, err := m.pick()
+	if err != nil {
+		return nil, err
+	}
+	return e.client.CreateSession(ctx, req)
+}
+
+func (m *MultiClient) Execute(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.ExecuteRequest],
+) (*connect.Response[psdbv1alpha1.ExecuteResponse], error) {
+	e, err := m.route(req.Msg.GetSession())
+	if err != nil {
+		return nil, err
+	}
+	return e.client.Execute(ctx, req)
+}
+
+func (m *MultiClient) StreamExecute(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.ExecuteRequest],
+) (*connect.ServerStreamForClient[psdbv1alpha1.ExecuteResponse], error) {
+	e, err := m.route(req.Msg.GetSession())
+	if err != nil {
+		return nil, err
+	}
+	return e.client.StreamExecute(ctx, req)
+}
+
+func (m *MultiClient) Prepare(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.PrepareRequest],
+) (*connect.Response[psdbv1alpha1.PrepareResponse], error) {
+	e, err := m.route(req.Msg.GetSession())
+	if err != nil {
+		return nil, err
+	}
+	return e.client.Prepare(ctx, req)
+}
+
+func (m *MultiClient) CloseSession(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.CloseSessionRequest],
+) (*connect.Response[psdbv1alpha1.CloseSessionResponse], error) {
+	e, err := m.route(req.Msg.GetSession())
+	if err != nil {
+		return nil, err
+	}
+	return e.client.CloseSession(ctx, req)
+}
+
+// endpointInterceptor keeps count of the calls in progress on an
+// endpoint, its health, and the sessions it issued.
+type endpointInterceptor struct {
+	multi    *MultiClient
+	endpoint *endpoint
+}
+
+func (i *endpointInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		i.endpoint.outstanding.Add(1)
+		defer i.endpoint.outstanding.Add(-1)
+		res, err := next(ctx, req)
+		i.endpoint.record(err, i.multi.health.Failures)
+		switch {
+		case err != nil:
+		case req.Spec().Procedure == psdbv1alpha1connect.DatabaseCloseSessionProcedure:
+			i.multi.forget(signatureOf(req.Any()))
+		default:
+			i.multi.track(i.endpoint, signatureOf(req.Any()), signatureOf(res.Any()))
+		}
+		return res, err
+	}
+}
+
+func (i *endpointInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		i.endpoint.outstanding.Add(1)
+		return &endpointStreamConn{StreamingClientConn: next(ctx, spec), interceptor: i}
+	}
+}
+
+func (*endpointInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+type endpointStreamConn struct {
+	connect.StreamingClientConn
+	interceptor *endpointInterceptor
+
+	once sync.Once
+	// sig is the latest signature seen on the stream
+	sig []byte
+}
+
+func (c *endpointStreamConn) Send(msg any) error {
+	if c.sig == nil {
+		c.sig = signatureOf(msg)
+	}
+	err := c.StreamingClientConn.Send(msg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.end(err)
+	}
+	return err
+}
+
+func (c *endpointStreamConn) Receive(msg any) error {
+	err := c.StreamingClientConn.Receive(msg)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.end(nil)
+	case err != nil:
+		c.end(err)
+	default:
+		if next := signatureOf(msg); len(next) > 0 {
+			c.interceptor.multi.track(c.interceptor.endpoint, c.sig, next)
+			c.sig = next
+		}
+	}
+	return err
+}
+
+func (c *endpointStreamConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	c.end(nil)
+	return err
+}
+
+func (c *endpointStreamConn) end(err error) {
+	c.once.Do(func() {
+		c.interceptor.endpoint.outstanding.Add(-1)
+		c.interceptor.endpoint.record(err, c.interceptor.multi.health.Failures)
+	})
+}
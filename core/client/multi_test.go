@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+func newMultiTestServers(t *testing.T, dbs ...*fakeDatabase) ([]string, []Option) {
+	var (
+		addrs []string
+		opts  []Option
+	)
+	for _, db := range dbs {
+		// every test server trusts the same certificate
+		addr, o := newTestServer(t, db)
+		addrs, opts = append(addrs, addr), o
+	}
+	return addrs, opts
+}
+
+func TestMultiClientSticky(t *testing.T) {
+	a, b := &fakeDatabase{name: "a"}, &fakeDatabase{name: "b"}
+	addrs, opts := newMultiTestServers(t, a, b)
+	multi := NewMultiClient(addrs, auth.NewBasicAuth("user", "pass"), opts...)
+	defer multi.Close()
+	ctx := context.Background()
+
+	conn1, err := NewConn(ctx, multi)
+	require.NoError(t, err)
+	conn2, err := NewConn(ctx, multi)
+	require.NoError(t, err)
+	assert.Equal(t, "a1", string(conn1.Signature()))
+	assert.Equal(t, "b1", string(conn2.Signature()))
+
+	for i := 0; i < 3; i++ {
+		_, err = conn1.Execute(ctx, "select 1", nil)
+		require.NoError(t, err)
+	}
+	stream, err := conn2.StreamExecute(ctx, "select 2", nil)
+	require.NoError(t, err)
+	for stream.Receive() {
+	}
+	require.NoError(t, stream.Err())
+	_, err = conn2.Execute(ctx, "select 3", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"select 1", "select 1", "select 1"}, a.queries)
+	assert.Equal(t, []string{"select 3"}, b.queries)
+
+	// removing an endpoint keeps its sessions on it
+	multi.SetAddrs(addrs[1:])
+	_, err = conn1.Execute(ctx, "select 4", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "select 4", a.queries[3])
+
+	require.NoError(t, conn1.Close(ctx))
+	require.NoError(t, conn2.Close(ctx))
+	assert.True(t, a.closed)
+	assert.True(t, b.closed)
+	assert.Empty(t, multi.sessions)
+
+	// a session it doesn't know isn't sent to just any endpoint
+	_, err = multi.Execute(ctx, connect.NewRequest(&psdbv1alpha1.ExecuteRequest{
+		Session: conn1.Session(),
+		Query:   "select 5",
+	}))
+	assert.ErrorIs(t, err, ErrUnknownSession)
+	assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+	assert.Len(t, a.queries, 4)
+	assert.Len(t, b.queries, 1)
+}
+
+func TestMultiClientResponseWithoutSession(t *testing.T) {
+	a, b := &fakeDatabase{name: "a"}, &fakeDatabase{name: "b"}
+	addrs, opts := newMultiTestServers(t, a, b)
+	multi := NewMultiClient(addrs, auth.NewBasicAuth("user", "pass"), opts...)
+	defer multi.Close()
+	ctx := context.Background()
+
+	conn, err := NewConn(ctx, multi)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "syntax error", nil)
+	assert.EqualError(t, err, "INVALID_ARGUMENT: syntax error")
+
+	// the Conn still has its previous Session, which must still route
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"syntax error", "select 1"}, a.queries)
+	require.NoError(t, conn.Close(ctx))
+	assert.Empty(t, multi.sessions)
+}
+
+func TestMultiClientUnhealthy(t *testing.T) {
+	a := &fakeDatabase{name: "a", failures: map[string]int{psdbv1alpha1connect.DatabaseCreateSessionProcedure: 1}}
+	b := &fakeDatabase{name: "b"}
+	addrs, opts := newMultiTestServers(t, a, b)
+	health := &HealthPolicy{Failures: 1, Cooldown: time.Hour}
+	multi := NewMultiClient(addrs, auth.NewBasicAuth("user", "pass"), append(opts, WithHealthPolicy(health))...)
+	defer multi.Close()
+	ctx := context.Background()
+
+	_, err := NewConn(ctx, multi)
+	require.Error(t, err)
+	assert.Equal(t, []EndpointStatus{{Addr: addrs[0]}, {Addr: addrs[1], Healthy: true}}, multi.Endpoints())
+
+	for i := 0; i < 3; i++ {
+		conn, err := NewConn(ctx, multi)
+		require.NoError(t, err)
+		assert.Equal(t, byte('b'), conn.Signature()[0])
+	}
+}
+
+func TestMultiClientProbe(t *testing.T) {
+	a := &fakeDatabase{name: "a", failures: map[string]int{psdbv1alpha1connect.DatabaseCreateSessionProcedure: 1}}
+	b := &fakeDatabase{name: "b"}
+	addrs, opts := newMultiTestServers(t, a, b)
+	health := &HealthPolicy{Failures: 1, Cooldown: time.Hour, ProbeInterval: 20 * time.Millisecond}
+	multi := NewMultiClient(addrs, auth.NewBasicAuth("user", "pass"), append(opts, WithHealthPolicy(health))...)
+	defer multi.Close()
+
+	_, err := NewConn(context.Background(), multi)
+	require.Error(t, err)
+	assert.Eventually(t, func() bool {
+		return multi.Endpoints()[0].Healthy
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		multi.sessionsMu.Lock()
+		defer multi.sessionsMu.Unlock()
+		return len(multi.sessions) == 0
+	}, time.Second, 10*time.Millisecond, "probe sessions are closed")
+}
+
+func TestMultiClientLeastOutstanding(t *testing.T) {
+	multi := NewMultiClient([]string{"a:443", "b:443", "c:443"}, auth.NewBasicAuth("user", "pass"), WithLoadBalancing(LeastOutstanding))
+	defer multi.Close()
+	multi.endpoints[0].outstanding.Store(2)
+	multi.endpoints[1].outstanding.Store(1)
+	multi.endpoints[2].outstanding.Store(3)
+
+	for i := 0; i < 3; i++ {
+		e, err := multi.pick()
+		require.NoError(t, err)
+		assert.Equal(t, "b:443", e.addr)
+	}
+
+	multi.SetAddrs(nil)
+	_, err := multi.pick()
+	assert.ErrorIs(t, err, ErrNoEndpoints)
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"connectrpc.com/connect"
+)
+
+var (
+	ErrPinMismatch = errors.New("no certificate matches a pinned key")
+	// ErrPinningUnsupported fails every call of a client whose pinned
+	// keys can't be applied, rather than letting calls go out unpinned.
+	ErrPinningUnsupported = errors.New("pinned keys can't be applied")
+)
+
+// PinError is returned by the TLS handshake when no certificate in the
+// server's chain matches a pin. It matches ErrPinMismatch.
+type PinError struct {
+	ServerName string
+	// Chain holds the SPKI hash of every certificate presented,
+	// from the leaf up.
+	Chain []string
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("%s for %s, server presented %s",
+		ErrPinMismatch, e.ServerName, strings.Join(e.Chain, ", "))
+}
+
+func (e *PinError) Unwrap() error {
+	return ErrPinMismatch
+}
+
+// SPKIHash returns the pin of cert: the base64 encoded SHA-256 of its
+// SubjectPublicKeyInfo, prefixed with "sha256/" like in HPKP.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// WithPinnedKeys only accepts servers whose certificate chain, after the
+// usual verification, has a certificate matching one of pins. Pinning the
+// key of an intermediate CA, rather than the server's, survives the server
+// certificate being renewed. Give several pins to rotate keys without
+// downtime. Pins are written as returned by SPKIHash, and also accepted
+// without the "sha256/" prefix. Only chains verified by crypto/tls are
+// checked, so with a tls.Config that sets InsecureSkipVerify, such as the
+// one from CertReloader.TLSConfig, every call fails with
+// ErrPinningUnsupported. Use WithCertReloader instead. With WithHTTPClient,
+// pins apply to a copy of its http.Transport, and calls through any other
+// HTTPClient fail with ErrPinningUnsupported too.
+func WithPinnedKeys(pins ...string) Option {
+	return func(c *config) {
+		for _, pin := range pins {
+			if !strings.HasPrefix(pin, "sha256/") {
+				pin = "sha256/" + pin
+			}
+			c.pins = append(c.pins, pin)
+		}
+	}
+}
+
+// withPinnedKeys returns a copy of cfg that also checks pins once the
+// connection is otherwise verified. A nil cfg starts from DefaultTLSConfig.
+func withPinnedKeys(cfg *tls.Config, pins []string) *tls.Config {
+	if cfg == nil {
+		cfg = DefaultTLSConfig()
+	}
+	cfg = cfg.Clone()
+	verify := cfg.VerifyConnection
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(cs); err != nil {
+				return err
+			}
+		}
+		return checkPins(cs, pins)
+	}
+	return cfg
+}
+
+func checkPins(cs tls.ConnectionState, pins []string) error {
+	// the presented certificates are only trusted once crypto/tls has
+	// verified them, pinning one of them otherwise proves nothing
+	if len(cs.VerifiedChains) == 0 {
+		return fmt.Errorf("%w for %s: the chain wasn't verified", ErrPinMismatch, cs.ServerName)
+	}
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			if slices.Contains(pins, SPKIHash(cert)) {
+				return nil
+			}
+		}
+	}
+	err := &PinError{ServerName: cs.ServerName}
+	for _, cert := range cs.PeerCertificates {
+		err.Chain = append(err.Chain, SPKIHash(cert))
+	}
+	return err
+}
+
+// checkPinnable tells why pins can't be checked on connections set up
+// with cfg, if they can't.
+func checkPinnable(cfg *tls.Config) error {
+	if cfg != nil && cfg.InsecureSkipVerify {
+		return fmt.Errorf("%w: InsecureSkipVerify leaves no verified chain to check them against", ErrPinningUnsupported)
+	}
+	return nil
+}
+
+// pinnedHTTPClient applies pins to a copy of a user supplied HTTPClient.
+func pinnedHTTPClient(client connect.HTTPClient, pins []string) connect.HTTPClient {
+	c, ok := client.(*http.Client)
+	if !ok {
+		return unpinnedHTTPClient{errNoTransport}
+	}
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return unpinnedHTTPClient{errNoTransport}
+	}
+	if err := checkPinnable(t.TLSClientConfig); err != nil {
+		return unpinnedHTTPClient{err}
+	}
+	t = t.Clone()
+	tlsConfig := t.TLSClientConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	t.TLSClientConfig = withPinnedKeys(tlsConfig, pins)
+	pinned := *c
+	pinned.Transport = t
+	return &pinned
+}
+
+var errNoTransport = fmt.Errorf("%w: they need an *http.Client with an *http.Transport", ErrPinningUnsupported)
+
+// unpinnedHTTPClient stands in for an HTTPClient that pins can't be
+// applied to, failing every call with err.
+type unpinnedHTTPClient struct {
+	err error
+}
+
+func (c unpinnedHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, c.err
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+)
+
+func TestPinnedKeys(t *testing.T) {
+	srv := newTLSTestServer(t, &fakeDatabase{})
+	addr := srv.Listener.Addr().String()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	pin := SPKIHash(srv.Certificate())
+	other := "sha256/" + strings.Repeat("A", 43) + "="
+
+	cases := []struct {
+		name string
+		pins []string
+		ok   bool
+	}{
+		{"match", []string{pin}, true},
+		{"without prefix", []string{strings.TrimPrefix(pin, "sha256/")}, true},
+		{"rotation", []string{other, pin}, true},
+		{"mismatch", []string{other}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conn, err := Dial(context.Background(), addr, auth.NewBasicAuth("user", "pass"),
+				WithTLSConfig(TLSConfigWithCertPool(roots)),
+				WithPinnedKeys(c.pins...),
+			)
+			if c.ok {
+				require.NoError(t, err)
+				_, err = conn.Execute(context.Background(), "select 1", nil)
+				assert.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrPinMismatch)
+			var pinErr *PinError
+			require.ErrorAs(t, err, &pinErr)
+			assert.Equal(t, []string{pin}, pinErr.Chain)
+			assert.ErrorContains(t, err, pin)
+		})
+	}
+}
+
+func TestPinnedKeysWithCertReloader(t *testing.T) {
+	srv := newTLSTestServer(t, &fakeDatabase{})
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"), filepath.Join(dir, "ca.crt")
+	cert, key := ca.issue(t, "client")
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+	writeFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	r, err := NewCertReloader(certFile, keyFile, caFile, 0)
+	require.NoError(t, err)
+
+	// pins are checked after the chain is verified with the reloader's CAs
+	_, err = Dial(context.Background(), srv.Listener.Addr().String(), auth.NewBasicAuth("user", "pass"),
+		WithCertReloader(r),
+		WithPinnedKeys(SPKIHash(ca.cert)),
+	)
+	assert.ErrorIs(t, err, ErrPinMismatch)
+
+	_, err = Dial(context.Background(), srv.Listener.Addr().String(), auth.NewBasicAuth("user", "pass"),
+		WithCertReloader(r),
+		WithPinnedKeys(SPKIHash(srv.Certificate())),
+	)
+	assert.NoError(t, err)
+}
+
+func TestPinnedKeysUnverified(t *testing.T) {
+	srv := newTLSTestServer(t, &fakeDatabase{})
+	addr := srv.Listener.Addr().String()
+
+	// a matching pin on a chain nobody verified proves nothing
+	_, err := Dial(context.Background(), addr, auth.NewBasicAuth("user", "pass"),
+		WithTLSConfig(&tls.Config{InsecureSkipVerify: true}),
+		WithPinnedKeys(SPKIHash(srv.Certificate())),
+	)
+	assert.ErrorIs(t, err, ErrPinningUnsupported)
+
+	// the reloader's own config verifies chains outside of crypto/tls,
+	// so it is refused before dialing rather than failing every handshake
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"), filepath.Join(dir, "ca.crt")
+	cert, key := ca.issue(t, "client")
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+	writeFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	r, err := NewCertReloader(certFile, keyFile, caFile, 0)
+	require.NoError(t, err)
+	_, err = Dial(context.Background(), addr, auth.NewBasicAuth("user", "pass"),
+		WithTLSConfig(r.TLSConfig()),
+		WithPinnedKeys(SPKIHash(srv.Certificate())),
+	)
+	assert.ErrorIs(t, err, ErrPinningUnsupported)
+	assert.ErrorContains(t, err, "InsecureSkipVerify")
+
+	insecure := srv.Client()
+	insecure.Transport.(*http.Transport).TLSClientConfig = r.TLSConfig()
+	_, err = Dial(context.Background(), addr, auth.NewBasicAuth("user", "pass"),
+		WithHTTPClient(insecure),
+		WithPinnedKeys(SPKIHash(srv.Certificate())),
+	)
+	assert.ErrorIs(t, err, ErrPinningUnsupported)
+}
+
+func TestPinnedKeysWithHTTPClient(t *testing.T) {
+	srv := newTLSTestServer(t, &fakeDatabase{})
+	addr := srv.Listener.Addr().String()
+	ctx := context.Background()
+
+	_, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"),
+		WithHTTPClient(srv.Client()),
+		WithPinnedKeys("sha256/"+strings.Repeat("A", 43)+"="),
+	)
+	assert.ErrorIs(t, err, ErrPinMismatch)
+
+	_, err = Dial(ctx, addr, auth.NewBasicAuth("user", "pass"),
+		WithHTTPClient(srv.Client()),
+		WithPinnedKeys(SPKIHash(srv.Certificate())),
+	)
+	assert.NoError(t, err)
+
+	_, err = Dial(ctx, addr, auth.NewBasicAuth("user", "pass"),
+		WithHTTPClient(&simpleClient{srv.Client().Transport}),
+		WithPinnedKeys(SPKIHash(srv.Certificate())),
+	)
+	assert.ErrorIs(t, err, ErrPinningUnsupported)
+}
@@ -0,0 +1,471 @@
+package client
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+
+	"github.com/planetscale/psdb/auth"
+)
+
+//enumcheck:exhaustive
+type EvictReason int
+
+const (
+	// EvictCapacity is an entry evicted to make room for a new one.
+	EvictCapacity EvictReason = iota
+	// EvictIdle is an entry unused for longer than the idle TTL.
+	EvictIdle
+	// EvictReleased is an entry removed by Release.
+	EvictReleased
+	// EvictClosed is an entry removed by Close.
+	EvictClosed
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictIdle:
+		return "idle"
+	case EvictReleased:
+		return "released"
+	case EvictClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+type poolEntry[T any] struct {
+	client T
+	key    poolKey
+	// lastUsed is in UnixNano, and updated without holding the pool lock
+	lastUsed atomic.Int64
+	// elem is the entry in the recency list, nil once removed from it
+	elem *list.Element
+}
+
+func (e *poolEntry[T]) touch(now time.Time) {
+	e.lastUsed.Store(now.UnixNano())
+}
+
+func (e *poolEntry[T]) idleSince(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, e.lastUsed.Load()))
+}
+
+// ClientPool holds one client per address, or per address and credentials
+// when using GetWithAuth. By default it grows without bound, see
+// WithPoolMaxSize and WithPoolIdleTTL.
+type ClientPool[T any] struct {
+	fn          func(connect.HTTPClient, string, ...connect.ClientOption) T
+	pool        map[poolKey]*poolEntry[T]
+	poolMu      sync.RWMutex
+	cfg         *config
+	credentials *credentialsInterceptor
+	pending     map[poolKey]*pendingClient[T]
+	closed      bool
+	done        chan struct{}
+	// recent orders entries from the most to the least recently used.
+	// recentMu is taken after poolMu, or on its own when touching an entry.
+	recent   *list.List
+	recentMu sync.Mutex
+	// authKey keys the HMAC of credentials in a poolKey
+	authKey []byte
+
+	hits, misses, constructions atomic.Uint64
+
+	// breakers are per address, and those not closed outlive the
+	// entries for it. addrs counts the entries per address, under poolMu.
+	breakersMu sync.Mutex
+	breakers   map[string]*circuitBreaker
+	addrs      map[string]int
+}
+
+type PoolStats struct {
+	// Hits is the number of calls to Get served by an existing client.
+	Hits uint64
+	// Misses is the number of calls to Get that had to wait for a client
+	// to be built, by themselves or by another caller.
+	Misses uint64
+	// Constructions is the number of clients built.
+	Constructions uint64
+	// Size is the number of clients currently in the pool.
+	Size int
+}
+
+func (p *ClientPool[T]) Stats() PoolStats {
+	return PoolStats{
+		Hits:          p.hits.Load(),
+		Misses:        p.misses.Load(),
+		Constructions: p.constructions.Load(),
+		Size:          p.Len(),
+	}
+}
+
+// poolKey identifies a pool entry. Credentials are only kept as an HMAC,
+// so the secret can't be read back out of the pool.
+type poolKey struct {
+	addr string
+	auth [sha256.Size]byte
+}
+
+func (p *ClientPool[T]) key(addr string, auth *auth.Authorization) poolKey {
+	key := poolKey{addr: addr}
+	if auth != nil {
+		mac := hmac.New(sha256.New, p.authKey)
+		mac.Write([]byte(authorizationHeader(auth)))
+		mac.Sum(key.auth[:0])
+	}
+	return key
+}
+
+// Get returns the unauthenticated client for addr.
+func (p *ClientPool[T]) Get(addr string) T {
+	return p.get(poolKey{addr: addr}, nil)
+}
+
+// GetWithAuth returns the client for addr that authenticates with auth.
+// Clients for different credentials are separate entries, but share
+// the same transport.
+func (p *ClientPool[T]) GetWithAuth(addr string, auth *auth.Authorization) T {
+	return p.get(p.key(addr, auth), auth)
+}
+
+func (p *ClientPool[T]) get(key poolKey, auth *auth.Authorization) T {
+	now := time.Now()
+
+	// First check the fast path, if there's already
+	// an initialized client for this address
+	p.poolMu.RLock()
+	entry, ok := p.pool[key]
+	closed := p.closed
+	p.poolMu.RUnlock()
+	if ok && !p.expired(entry, now) {
+		p.hits.Add(1)
+		p.touch(entry, now)
+		return entry.client
+	}
+	p.misses.Add(1)
+	if closed {
+		return p.newClient(key.addr, auth)
+	}
+	return p.getSlow(key, auth, now)
+}
+
+// pendingClient is a client being built by one caller of Get, which
+// every other caller for the same address waits on.
+type pendingClient[T any] struct {
+	done   chan struct{}
+	client T
+	ok     bool
+}
+
+func (p *ClientPool[T]) getSlow(key poolKey, auth *auth.Authorization, now time.Time) T {
+	p.poolMu.Lock()
+	// another caller may have stored or started building
+	// the client since the fast path
+	if entry, ok := p.pool[key]; ok && !p.expired(entry, now) {
+		p.poolMu.Unlock()
+		p.touch(entry, now)
+		return entry.client
+	}
+	if pending, ok := p.pending[key]; ok {
+		p.poolMu.Unlock()
+		<-pending.done
+		if pending.ok {
+			return pending.client
+		}
+		// the constructor panicked, try again ourselves
+		return p.get(key, auth)
+	}
+	pending := &pendingClient[T]{done: make(chan struct{})}
+	p.pending[key] = pending
+	p.poolMu.Unlock()
+
+	defer func() {
+		if !pending.ok {
+			p.poolMu.Lock()
+			delete(p.pending, key)
+			p.poolMu.Unlock()
+			close(pending.done)
+		}
+	}()
+
+	// build the client outside of the lock, so other
+	// addresses aren't held up by a slow constructor
+	entry := &poolEntry[T]{client: p.newClient(key.addr, auth), key: key}
+	entry.touch(now)
+
+	var evicted []eviction
+	p.poolMu.Lock()
+	delete(p.pending, key)
+	if !p.closed {
+		if _, ok := p.pool[key]; ok {
+			// only an expired entry can still be here
+			p.removeLocked(key)
+			evicted = append(evicted, eviction{key, EvictIdle})
+		} else {
+			evicted = append(evicted, p.makeRoomLocked()...)
+		}
+		p.insertLocked(entry)
+	}
+	pending.client, pending.ok = entry.client, true
+	p.poolMu.Unlock()
+	close(pending.done)
+
+	p.notify(evicted)
+	return entry.client
+}
+
+func (p *ClientPool[T]) newClient(addr string, auth *auth.Authorization) T {
+	p.constructions.Add(1)
+	var interceptors []connect.Interceptor
+	if b := p.breaker(addr); b != nil {
+		interceptors = append(interceptors, newBreakerInterceptor(b))
+	}
+	switch {
+	case auth != nil:
+		interceptors = append(interceptors, newAuthInterceptor(auth))
+	case p.credentials != nil:
+		interceptors = append(interceptors, p.credentials)
+	}
+	return p.fn(p.cfg.httpClient, baseURL(addr), clientOptions(p.cfg, interceptors...)...)
+}
+
+// breaker returns the circuit breaker for addr, or nil without
+// WithCircuitBreaker.
+func (p *ClientPool[T]) breaker(addr string) *circuitBreaker {
+	if p.cfg.breakerPolicy == nil {
+		return nil
+	}
+	p.breakersMu.Lock()
+	defer p.breakersMu.Unlock()
+	b, ok := p.breakers[addr]
+	if !ok {
+		b = newCircuitBreaker(addr, p.cfg.breakerPolicy)
+		p.breakers[addr] = b
+	}
+	return b
+}
+
+// BreakerStates returns the state of the circuit breaker of every address
+// the pool holds a client for, and of released addresses whose breaker
+// hasn't closed again. It is empty without WithCircuitBreaker.
+func (p *ClientPool[T]) BreakerStates() map[string]BreakerState {
+	p.breakersMu.Lock()
+	defer p.breakersMu.Unlock()
+	states := make(map[string]BreakerState, len(p.breakers))
+	for addr, b := range p.breakers {
+		states[addr] = b.State()
+	}
+	return states
+}
+
+func (p *ClientPool[T]) expired(e *poolEntry[T], now time.Time) bool {
+	return p.cfg.poolIdleTTL > 0 && e.idleSince(now) > p.cfg.poolIdleTTL
+}
+
+// touch marks entry as the most recently used.
+func (p *ClientPool[T]) touch(entry *poolEntry[T], now time.Time) {
+	entry.touch(now)
+	p.recentMu.Lock()
+	// the entry may have been removed since it was looked up
+	if entry.elem != nil {
+		p.recent.MoveToFront(entry.elem)
+	}
+	p.recentMu.Unlock()
+}
+
+// insertLocked adds entry to the pool as the most recently used. It must
+// be called with poolMu held.
+func (p *ClientPool[T]) insertLocked(entry *poolEntry[T]) {
+	p.pool[entry.key] = entry
+	p.addrs[entry.key.addr]++
+	p.recentMu.Lock()
+	entry.elem = p.recent.PushFront(entry)
+	p.recentMu.Unlock()
+}
+
+// removeLocked removes the entry for key. It must be called with poolMu
+// held.
+func (p *ClientPool[T]) removeLocked(key poolKey) {
+	entry, ok := p.pool[key]
+	if !ok {
+		return
+	}
+	delete(p.pool, key)
+	p.recentMu.Lock()
+	p.recent.Remove(entry.elem)
+	entry.elem = nil
+	p.recentMu.Unlock()
+	if p.addrs[key.addr]--; p.addrs[key.addr] == 0 {
+		delete(p.addrs, key.addr)
+		p.pruneBreaker(key.addr)
+	}
+}
+
+// pruneBreaker drops the circuit breaker for addr if it is closed. An open
+// one is kept, so that a new client for addr doesn't call it before it
+// has recovered.
+func (p *ClientPool[T]) pruneBreaker(addr string) {
+	p.breakersMu.Lock()
+	defer p.breakersMu.Unlock()
+	if b, ok := p.breakers[addr]; ok && b.State() == BreakerClosed {
+		delete(p.breakers, addr)
+	}
+}
+
+type eviction struct {
+	key    poolKey
+	reason EvictReason
+}
+
+// makeRoomLocked evicts the least recently used entries until there is
+// room for one more. It must be called with poolMu held.
+func (p *ClientPool[T]) makeRoomLocked() []eviction {
+	if p.cfg.poolMaxSize <= 0 {
+		return nil
+	}
+	var evicted []eviction
+	for len(p.pool) >= p.cfg.poolMaxSize {
+		p.recentMu.Lock()
+		oldest := p.recent.Back().Value.(*poolEntry[T])
+		p.recentMu.Unlock()
+		p.removeLocked(oldest.key)
+		evicted = append(evicted, eviction{oldest.key, EvictCapacity})
+	}
+	return evicted
+}
+
+// notify calls the eviction callback, outside of the pool lock.
+func (p *ClientPool[T]) notify(evicted []eviction) {
+	if p.cfg.poolOnEvict == nil {
+		return
+	}
+	for _, e := range evicted {
+		p.cfg.poolOnEvict(e.key.addr, e.reason)
+	}
+}
+
+// Release removes every client for addr, whatever its credentials.
+func (p *ClientPool[T]) Release(addr string) {
+	var evicted []eviction
+	p.poolMu.Lock()
+	for key := range p.pool {
+		if key.addr == addr {
+			p.removeLocked(key)
+			evicted = append(evicted, eviction{key, EvictReleased})
+		}
+	}
+	p.poolMu.Unlock()
+	p.notify(evicted)
+}
+
+// ReleaseWithAuth removes the client for addr and auth.
+func (p *ClientPool[T]) ReleaseWithAuth(addr string, auth *auth.Authorization) {
+	key := p.key(addr, auth)
+	p.poolMu.Lock()
+	_, ok := p.pool[key]
+	p.removeLocked(key)
+	p.poolMu.Unlock()
+	if ok {
+		p.notify([]eviction{{key, EvictReleased}})
+	}
+}
+
+func (p *ClientPool[T]) Len() int {
+	p.poolMu.RLock()
+	defer p.poolMu.RUnlock()
+	return len(p.pool)
+}
+
+// Close empties the pool and closes the idle connections of the shared
+// transport. After Close, Get still works, but builds a new client on
+// every call.
+func (p *ClientPool[T]) Close() {
+	p.poolMu.Lock()
+	if p.closed {
+		p.poolMu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	evicted := make([]eviction, 0, len(p.pool))
+	for key := range p.pool {
+		evicted = append(evicted, eviction{key, EvictClosed})
+	}
+	clear(p.pool)
+	for addr := range p.addrs {
+		p.pruneBreaker(addr)
+	}
+	clear(p.addrs)
+	p.recentMu.Lock()
+	for elem := p.recent.Front(); elem != nil; elem = elem.Next() {
+		elem.Value.(*poolEntry[T]).elem = nil
+	}
+	p.recent.Init()
+	p.recentMu.Unlock()
+	p.poolMu.Unlock()
+
+	p.notify(evicted)
+	if c, ok := p.cfg.httpClient.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// sweep evicts idle entries every half TTL, until the pool is closed.
+func (p *ClientPool[T]) sweep() {
+	t := time.NewTicker(p.cfg.poolIdleTTL / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-t.C:
+			var evicted []eviction
+			p.poolMu.Lock()
+			for key, e := range p.pool {
+				if p.expired(e, now) {
+					p.removeLocked(key)
+					evicted = append(evicted, eviction{key, EvictIdle})
+				}
+			}
+			p.poolMu.Unlock()
+			p.notify(evicted)
+		}
+	}
+}
+
+func NewUnauthenticatedPool[T any](
+	fn func(connect.HTTPClient, string, ...connect.ClientOption) T,
+	opts ...Option,
+) *ClientPool[T] {
+	cfg := configFromOptions(opts...)
+
+	p := &ClientPool[T]{
+		fn:       fn,
+		pool:     make(map[poolKey]*poolEntry[T]),
+		pending:  make(map[poolKey]*pendingClient[T]),
+		recent:   list.New(),
+		cfg:      cfg,
+		done:     make(chan struct{}),
+		authKey:  make([]byte, sha256.Size),
+		breakers: make(map[string]*circuitBreaker),
+		addrs:    make(map[string]int),
+	}
+	if cfg.credentials != nil {
+		p.credentials = newCredentialsInterceptor(cfg.credentials)
+	}
+	// crypto/rand.Read never returns an error
+	_, _ = rand.Read(p.authKey)
+	if cfg.poolIdleTTL > 0 {
+		go p.sweep()
+	}
+	return p
+}
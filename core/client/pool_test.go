@@ -0,0 +1,236 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+type testPoolClient struct {
+	addr string
+}
+
+func newTestPoolClient(_ connect.HTTPClient, addr string, _ ...connect.ClientOption) *testPoolClient {
+	return &testPoolClient{addr: addr}
+}
+
+type fakeHTTPClient struct {
+	mu         sync.Mutex
+	idleClosed int
+}
+
+func (*fakeHTTPClient) Do(*http.Request) (*http.Response, error) {
+	panic("not implemented")
+}
+
+func (c *fakeHTTPClient) CloseIdleConnections() {
+	c.mu.Lock()
+	c.idleClosed++
+	c.mu.Unlock()
+}
+
+type testEviction struct {
+	addr   string
+	reason EvictReason
+}
+
+type evictionRecorder struct {
+	mu      sync.Mutex
+	evicted []testEviction
+}
+
+func (r *evictionRecorder) record(addr string, reason EvictReason) {
+	r.mu.Lock()
+	r.evicted = append(r.evicted, testEviction{addr, reason})
+	r.mu.Unlock()
+}
+
+func (r *evictionRecorder) get() []testEviction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]testEviction(nil), r.evicted...)
+}
+
+func TestPoolMaxSize(t *testing.T) {
+	var rec evictionRecorder
+	pool := NewUnauthenticatedPool(newTestPoolClient,
+		WithHTTPClient(&fakeHTTPClient{}),
+		WithPoolMaxSize(2),
+		WithPoolEvictionCallback(rec.record),
+	)
+	defer pool.Close()
+
+	a := pool.Get("a")
+	assert.Equal(t, "https://a", a.addr)
+	pool.Get("b")
+	assert.Same(t, a, pool.Get("a"))
+	pool.Get("c")
+
+	assert.Equal(t, 2, pool.Len())
+	assert.Equal(t, []testEviction{{"b", EvictCapacity}}, rec.get())
+	assert.Same(t, a, pool.Get("a"))
+
+	pool.Release("a")
+	pool.Release("a")
+	assert.Equal(t, []testEviction{{"b", EvictCapacity}, {"a", EvictReleased}}, rec.get())
+	assert.NotSame(t, a, pool.Get("a"))
+}
+
+func TestPoolIdleTTL(t *testing.T) {
+	var rec evictionRecorder
+	pool := NewUnauthenticatedPool(newTestPoolClient,
+		WithHTTPClient(&fakeHTTPClient{}),
+		WithPoolIdleTTL(20*time.Millisecond),
+		WithPoolEvictionCallback(rec.record),
+	)
+	defer pool.Close()
+
+	a := pool.Get("a")
+	assert.Same(t, a, pool.Get("a"))
+
+	assert.Eventually(t, func() bool { return pool.Len() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []testEviction{{"a", EvictIdle}}, rec.get())
+	assert.NotSame(t, a, pool.Get("a"))
+}
+
+func TestPoolClose(t *testing.T) {
+	var rec evictionRecorder
+	httpClient := &fakeHTTPClient{}
+	pool := NewUnauthenticatedPool(newTestPoolClient,
+		WithHTTPClient(httpClient),
+		WithPoolEvictionCallback(rec.record),
+	)
+
+	a := pool.Get("a")
+	pool.Close()
+	pool.Close()
+
+	assert.Equal(t, 0, pool.Len())
+	assert.Equal(t, 1, httpClient.idleClosed)
+	assert.Equal(t, []testEviction{{"a", EvictClosed}}, rec.get())
+
+	// no more reuse once closed
+	assert.NotSame(t, a, pool.Get("a"))
+	assert.Equal(t, 0, pool.Len())
+}
+
+func TestPoolSingleFlight(t *testing.T) {
+	const n = 64
+	var (
+		calls   atomic.Int32
+		release = make(chan struct{})
+	)
+	pool := NewUnauthenticatedPool(
+		func(_ connect.HTTPClient, addr string, _ ...connect.ClientOption) *testPoolClient {
+			calls.Add(1)
+			<-release
+			return &testPoolClient{addr: addr}
+		},
+		WithHTTPClient(&fakeHTTPClient{}),
+	)
+	defer pool.Close()
+
+	var (
+		wg      sync.WaitGroup
+		clients [n]*testPoolClient
+	)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clients[i] = pool.Get("cold")
+		}()
+	}
+	// let every goroutine reach the pool before the constructor returns
+	assert.Eventually(t, func() bool { return pool.Stats().Misses == n }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for _, c := range clients {
+		assert.Same(t, clients[0], c)
+	}
+	assert.Same(t, clients[0], pool.Get("cold"))
+	assert.Equal(t, PoolStats{Hits: 1, Misses: n, Constructions: 1, Size: 1}, pool.Stats())
+}
+
+func TestPoolSingleFlightPanic(t *testing.T) {
+	var calls atomic.Int32
+	pool := NewUnauthenticatedPool(
+		func(_ connect.HTTPClient, addr string, _ ...connect.ClientOption) *testPoolClient {
+			if calls.Add(1) == 1 {
+				panic("boom")
+			}
+			return &testPoolClient{addr: addr}
+		},
+		WithHTTPClient(&fakeHTTPClient{}),
+	)
+	defer pool.Close()
+
+	assert.Panics(t, func() { pool.Get("a") })
+	assert.Equal(t, "https://a", pool.Get("a").addr)
+	assert.Equal(t, 1, pool.Len())
+}
+
+func TestPoolWithAuth(t *testing.T) {
+	pool := NewUnauthenticatedPool(newTestPoolClient, WithHTTPClient(&fakeHTTPClient{}))
+	defer pool.Close()
+
+	alice := auth.NewBasicAuth("alice", "secret-a")
+	bob := auth.NewBasicAuth("bob", "secret-b")
+
+	a := pool.GetWithAuth("db", alice)
+	b := pool.GetWithAuth("db", bob)
+	u := pool.Get("db")
+	assert.NotSame(t, a, b)
+	assert.NotSame(t, a, u)
+	assert.Same(t, a, pool.GetWithAuth("db", auth.NewBasicAuth("alice", "secret-a")))
+	assert.Equal(t, 3, pool.Len())
+
+	// the secret never appears in a key
+	pool.poolMu.RLock()
+	for key := range pool.pool {
+		assert.NotContains(t, fmt.Sprintf("%#v", key), "secret")
+		assert.NotContains(t, fmt.Sprintf("%#v", key), alice.HeaderValue())
+	}
+	pool.poolMu.RUnlock()
+
+	pool.ReleaseWithAuth("db", alice)
+	assert.Equal(t, 2, pool.Len())
+	pool.Release("db")
+	assert.Equal(t, 0, pool.Len())
+}
+
+func TestPoolWithAuthHeaders(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	pool := NewUnauthenticatedPool(psdbv1alpha1connect.NewDatabaseClient, opts...)
+	defer pool.Close()
+	ctx := context.Background()
+
+	for _, a := range []*auth.Authorization{
+		auth.NewBasicAuth("alice", "a"),
+		auth.NewBasicAuth("bob", "b"),
+	} {
+		_, err := pool.GetWithAuth(addr, a).CreateSession(ctx, connect.NewRequest(&psdbv1alpha1.CreateSessionRequest{}))
+		require.NoError(t, err)
+	}
+	_, err := pool.Get(addr).CreateSession(ctx, connect.NewRequest(&psdbv1alpha1.CreateSessionRequest{}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Basic YWxpY2U6YQ==", db.headers[0].Get("Authorization"))
+	assert.Equal(t, "Basic Ym9iOmI=", db.headers[1].Get("Authorization"))
+	assert.Equal(t, "", db.headers[2].Get("Authorization"))
+}
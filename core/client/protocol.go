@@ -0,0 +1,52 @@
+package client
+
+import "connectrpc.com/connect"
+
+// Protocol is the wire protocol clients speak to the server.
+//
+//enumcheck:exhaustive
+type Protocol int
+
+const (
+	// ProtocolConnect is the Connect protocol, the default.
+	ProtocolConnect Protocol = iota
+	// ProtocolGRPC is gRPC, for proxies and load balancers that only
+	// understand gRPC. It needs HTTP/2.
+	ProtocolGRPC
+	// ProtocolGRPCWeb is gRPC-Web, which works over HTTP/1.1 as well.
+	ProtocolGRPCWeb
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolConnect:
+		return "connect"
+	case ProtocolGRPC:
+		return "grpc"
+	case ProtocolGRPCWeb:
+		return "grpcweb"
+	}
+	return "unknown"
+}
+
+// clientOption returns the connect.ClientOption selecting p, or nil for
+// the default.
+func (p Protocol) clientOption() connect.ClientOption {
+	switch p {
+	case ProtocolConnect:
+		return nil
+	case ProtocolGRPC:
+		return connect.WithGRPC()
+	case ProtocolGRPCWeb:
+		return connect.WithGRPCWeb()
+	}
+	return nil
+}
+
+// WithProtocol makes clients speak p rather than the Connect protocol.
+// The codec and compression are the same whatever the protocol.
+func WithProtocol(p Protocol) Option {
+	return func(c *config) {
+		c.protocol = p
+	}
+}
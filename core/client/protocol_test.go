@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"connectrpc.com/connect"
+	compress "github.com/klauspost/connect-compress/v2"
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	"github.com/planetscale/psdb/core/codec"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+	psdbconnectv1alpha1 "github.com/planetscale/psdb/types/psdbconnect/v1alpha1"
+	"github.com/planetscale/psdb/types/psdbconnect/v1alpha1/psdbconnectv1alpha1connect"
+)
+
+// fakeConnect is an in-memory Connect service, whose Sync streams two
+// batches of rows for the requested table.
+type fakeConnect struct {
+	psdbconnectv1alpha1connect.UnimplementedConnectHandler
+}
+
+func (fakeConnect) Sync(
+	ctx context.Context,
+	req *connect.Request[psdbconnectv1alpha1.SyncRequest],
+	stream *connect.ServerStream[psdbconnectv1alpha1.SyncResponse],
+) error {
+	for _, position := range []string{"1", "2"} {
+		if err := stream.Send(&psdbconnectv1alpha1.SyncResponse{
+			Result: []*querypb.QueryResult{{Rows: []*querypb.Row{{}, {}}}},
+			Cursor: &psdbconnectv1alpha1.TableCursor{Keyspace: req.Msg.TableName, Position: position},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestLog records the content type and encoding of every request.
+type requestLog struct {
+	mu        sync.Mutex
+	types     map[string]bool
+	encodings map[string]bool
+}
+
+func (l *requestLog) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		l.types[r.Header.Get("Content-Type")] = true
+		for _, key := range []string{"Content-Encoding", "Connect-Content-Encoding", "Grpc-Encoding"} {
+			if v := r.Header.Get(key); v != "" {
+				l.encodings[v] = true
+			}
+		}
+		l.mu.Unlock()
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestProtocols(t *testing.T) {
+	cases := []struct {
+		protocol Protocol
+		types    []string
+		system   string
+	}{
+		{ProtocolConnect, []string{"application/proto", "application/connect+proto"}, "connect_rpc"},
+		{ProtocolGRPC, []string{"application/grpc"}, "grpc"},
+		{ProtocolGRPCWeb, []string{"application/grpc-web+proto"}, "grpc_web"},
+	}
+	for _, c := range cases {
+		t.Run(c.protocol.String(), func(t *testing.T) {
+			log := &requestLog{types: make(map[string]bool), encodings: make(map[string]bool)}
+			handlerOpts := []connect.HandlerOption{
+				compress.WithAll(compress.LevelFastest),
+				connect.WithCodec(codec.DefaultCodec),
+			}
+			mux := http.NewServeMux()
+			path, h := psdbv1alpha1connect.NewDatabaseHandler(&fakeDatabase{}, handlerOpts...)
+			mux.Handle(path, log.wrap(h))
+			path, h = psdbconnectv1alpha1connect.NewConnectHandler(fakeConnect{}, handlerOpts...)
+			mux.Handle(path, log.wrap(h))
+			srv := httptest.NewUnstartedServer(mux)
+			srv.EnableHTTP2 = true
+			srv.StartTLS()
+			t.Cleanup(srv.Close)
+
+			tracer := &memoryTracer{}
+			addr := srv.Listener.Addr().String()
+			opts := []Option{WithHTTPClient(srv.Client()), WithProtocol(c.protocol), WithTracer(tracer)}
+			ctx := context.Background()
+
+			conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), opts...)
+			require.NoError(t, err)
+			res, err := conn.Execute(ctx, "select 1", nil)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(1), res.GetResult().GetRowsAffected())
+
+			stream, err := conn.StreamExecute(ctx, "select 1", nil)
+			require.NoError(t, err)
+			var rows int
+			for stream.Receive() {
+				rows += len(stream.Msg().GetResult().GetRows())
+			}
+			require.NoError(t, stream.Err())
+			assert.Equal(t, 6, rows)
+
+			sync := New(addr, psdbconnectv1alpha1connect.NewConnectClient, auth.NewBasicAuth("user", "pass"), opts...)
+			syncStream, err := sync.Sync(ctx, connect.NewRequest(&psdbconnectv1alpha1.SyncRequest{TableName: "users"}))
+			require.NoError(t, err)
+			var positions []string
+			for syncStream.Receive() {
+				positions = append(positions, syncStream.Msg().GetCursor().GetPosition())
+			}
+			require.NoError(t, syncStream.Err())
+			assert.Equal(t, []string{"1", "2"}, positions)
+
+			log.mu.Lock()
+			for _, ct := range c.types {
+				assert.True(t, log.types[ct], "content type %s, got %v", ct, log.types)
+			}
+			assert.Len(t, log.types, len(c.types))
+			assert.Equal(t, map[string]bool{compress.S2: true}, log.encodings)
+			log.mu.Unlock()
+
+			tracer.mu.Lock()
+			for _, span := range tracer.spans {
+				assert.Equal(t, c.system, span.attrs[AttrRPCSystem])
+			}
+			tracer.mu.Unlock()
+		})
+	}
+}
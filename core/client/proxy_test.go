@@ -0,0 +1,273 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"connectrpc.com/connect"
+	compress "github.com/klauspost/connect-compress/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	"github.com/planetscale/psdb/core/codec"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+// tunnel copies between a and b until either side is done.
+func tunnel(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(a, b)
+		a.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(b, a)
+		b.Close()
+	}()
+	wg.Wait()
+}
+
+// newConnectProxy starts an HTTP proxy that only supports CONNECT, and
+// requires username and password when set. It counts the tunnels opened.
+func newConnectProxy(t *testing.T, username, password string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var tunnels atomic.Int32
+	want := "Basic " + auth.NewBasicAuth(username, password).HeaderValue()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT", http.StatusMethodNotAllowed)
+			return
+		}
+		if username != "" && r.Header.Get("Proxy-Authorization") != want {
+			http.Error(w, "bad credentials", http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		if buf.Reader.Buffered() > 0 {
+			b, _ := buf.Peek(buf.Reader.Buffered())
+			_, _ = upstream.Write(b)
+		}
+		tunnels.Add(1)
+		tunnel(conn, upstream)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &tunnels
+}
+
+// newSOCKS5Proxy starts a SOCKS5 proxy supporting CONNECT, that requires
+// username and password authentication when set. It counts the tunnels
+// opened.
+func newSOCKS5Proxy(t *testing.T, username, password string) (net.Listener, *atomic.Int32) {
+	t.Helper()
+	var tunnels atomic.Int32
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				upstream, err := socks5Handshake(conn, username, password)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				tunnels.Add(1)
+				tunnel(conn, upstream)
+			}()
+		}
+	}()
+	return ln, &tunnels
+}
+
+func socks5Handshake(conn net.Conn, username, password string) (net.Conn, error) {
+	r := bufio.NewReader(conn)
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return nil, err
+	}
+	if username == "" {
+		if _, err := conn.Write([]byte{5, 0}); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write([]byte{5, 2}); err != nil {
+			return nil, err
+		}
+		var ver [1]byte
+		if _, err := io.ReadFull(r, ver[:]); err != nil {
+			return nil, err
+		}
+		user, err := readSOCKS5String(r)
+		if err != nil {
+			return nil, err
+		}
+		pass, err := readSOCKS5String(r)
+		if err != nil {
+			return nil, err
+		}
+		if user != username || pass != password {
+			_, _ = conn.Write([]byte{1, 1})
+			return nil, errors.New("bad credentials")
+		}
+		if _, err := conn.Write([]byte{1, 0}); err != nil {
+			return nil, err
+		}
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(r, req[:]); err != nil {
+		return nil, err
+	}
+	var host string
+	switch req[3] {
+	case 1, 4:
+		ip := make(net.IP, 4)
+		if req[3] == 4 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return nil, err
+		}
+		host = ip.String()
+	case 3:
+		name, err := readSOCKS5String(r)
+		if err != nil {
+			return nil, err
+		}
+		host = name
+	default:
+		return nil, errors.New("bad address type")
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return nil, err
+	}
+	upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))))
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	return upstream, nil
+}
+
+func readSOCKS5String(r *bufio.Reader) (string, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return string(b), err
+}
+
+func TestProxy(t *testing.T) {
+	var protos sync.Map
+	mux := http.NewServeMux()
+	path, handler := psdbv1alpha1connect.NewDatabaseHandler(&fakeDatabase{},
+		compress.WithAll(compress.LevelFastest),
+		connect.WithCodec(codec.DefaultCodec),
+	)
+	mux.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos.Store(r.Proto, true)
+		handler.ServeHTTP(w, r)
+	}))
+	srv := httptest.NewUnstartedServer(mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	httpProxy, httpTunnels := newConnectProxy(t, "proxy-user", "proxy-pass")
+	socksProxy, socksTunnels := newSOCKS5Proxy(t, "proxy-user", "proxy-pass")
+
+	cases := []struct {
+		name    string
+		proxy   *url.URL
+		tunnels *atomic.Int32
+		err     string
+	}{
+		{
+			name:    "connect",
+			proxy:   &url.URL{Scheme: "http", Host: httpProxy.Listener.Addr().String(), User: url.UserPassword("proxy-user", "proxy-pass")},
+			tunnels: httpTunnels,
+		},
+		{
+			name:  "connect with bad credentials",
+			proxy: &url.URL{Scheme: "http", Host: httpProxy.Listener.Addr().String(), User: url.UserPassword("proxy-user", "wrong")},
+			err:   "Proxy Authentication Required",
+		},
+		{
+			name:    "socks5",
+			proxy:   &url.URL{Scheme: "socks5", Host: socksProxy.Addr().String(), User: url.UserPassword("proxy-user", "proxy-pass")},
+			tunnels: socksTunnels,
+		},
+		{
+			name:  "socks5 with bad credentials",
+			proxy: &url.URL{Scheme: "socks5", Host: socksProxy.Addr().String(), User: url.UserPassword("proxy-user", "wrong")},
+			err:   "username/password authentication failed",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conn, err := Dial(context.Background(), srv.Listener.Addr().String(), auth.NewBasicAuth("user", "pass"),
+				WithTLSConfig(TLSConfigWithCertPool(roots)),
+				WithProxy(http.ProxyURL(c.proxy)),
+			)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			_, err = conn.Execute(context.Background(), "select 1", nil)
+			require.NoError(t, err)
+			// both calls share one tunnel
+			assert.Equal(t, int32(1), c.tunnels.Load())
+		})
+	}
+
+	var seen []string
+	protos.Range(func(k, _ any) bool {
+		seen = append(seen, k.(string))
+		return true
+	})
+	assert.Equal(t, []string{"HTTP/2.0"}, seen)
+}
@@ -0,0 +1,281 @@
+package client
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	sizeBuckets    = []float64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+)
+
+type histogram struct {
+	bounds []float64
+	// counts are not cumulative, the last one counts
+	// observations above every bound
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i, _ := slices.BinarySearch(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+type procedureMetrics struct {
+	codes            map[string]uint64
+	vtrpcCodes       map[string]uint64
+	requestMessages  uint64
+	responseMessages uint64
+	inFlight         int64
+
+	latency           *histogram
+	serverTiming      *histogram
+	requestBytes      *histogram
+	responseBytes     *histogram
+	wireRequestBytes  *histogram
+	wireResponseBytes *histogram
+}
+
+// metricsSet aggregates RPCStats in memory, per procedure. It backs the
+// expvar and Prometheus recorders.
+type metricsSet struct {
+	mu         sync.Mutex
+	procedures map[string]*procedureMetrics
+}
+
+func newMetricsSet() *metricsSet {
+	return &metricsSet{procedures: make(map[string]*procedureMetrics)}
+}
+
+// procedureLocked must be called with mu held.
+func (s *metricsSet) procedureLocked(procedure string) *procedureMetrics {
+	m, ok := s.procedures[procedure]
+	if !ok {
+		m = &procedureMetrics{
+			codes:             make(map[string]uint64),
+			vtrpcCodes:        make(map[string]uint64),
+			latency:           newHistogram(latencyBuckets),
+			serverTiming:      newHistogram(latencyBuckets),
+			requestBytes:      newHistogram(sizeBuckets),
+			responseBytes:     newHistogram(sizeBuckets),
+			wireRequestBytes:  newHistogram(sizeBuckets),
+			wireResponseBytes: newHistogram(sizeBuckets),
+		}
+		s.procedures[procedure] = m
+	}
+	return m
+}
+
+func (s *metricsSet) StreamStarted(procedure string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.procedureLocked(procedure).inFlight++
+}
+
+func (s *metricsSet) StreamEnded(procedure string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.procedureLocked(procedure).inFlight--
+}
+
+func (s *metricsSet) RecordRPC(stats RPCStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.procedureLocked(stats.Procedure)
+	m.codes[stats.Code]++
+	if stats.VTRPCCode != 0 {
+		m.vtrpcCodes[stats.VTRPCCode.String()]++
+	}
+	m.requestMessages += uint64(stats.RequestMessages)
+	m.responseMessages += uint64(stats.ResponseMessages)
+	m.latency.observe(stats.Latency.Seconds())
+	if stats.ServerTiming > 0 {
+		m.serverTiming.observe(stats.ServerTiming.Seconds())
+	}
+	m.requestBytes.observe(float64(stats.RequestBytes))
+	m.responseBytes.observe(float64(stats.ResponseBytes))
+	m.wireRequestBytes.observe(float64(stats.WireRequestBytes))
+	m.wireResponseBytes.observe(float64(stats.WireResponseBytes))
+}
+
+// ExpvarRecorder is a Recorder published as an expvar variable.
+type ExpvarRecorder struct {
+	*metricsSet
+}
+
+// NewExpvarRecorder publishes a new ExpvarRecorder under name. Like
+// expvar.Publish, it panics if name is already in use.
+func NewExpvarRecorder(name string) *ExpvarRecorder {
+	r := &ExpvarRecorder{newMetricsSet()}
+	expvar.Publish(name, expvar.Func(r.snapshot))
+	return r
+}
+
+type expvarHistogram struct {
+	Buckets map[string]uint64 `json:"buckets"`
+	Sum     float64           `json:"sum"`
+	Count   uint64            `json:"count"`
+}
+
+type expvarProcedure struct {
+	Codes             map[string]uint64 `json:"codes"`
+	VTRPCCodes        map[string]uint64 `json:"vtrpc_codes"`
+	RequestMessages   uint64            `json:"request_messages"`
+	ResponseMessages  uint64            `json:"response_messages"`
+	InFlight          int64             `json:"in_flight"`
+	Latency           expvarHistogram   `json:"latency_seconds"`
+	ServerTiming      expvarHistogram   `json:"server_timing_seconds"`
+	RequestBytes      expvarHistogram   `json:"request_bytes"`
+	ResponseBytes     expvarHistogram   `json:"response_bytes"`
+	WireRequestBytes  expvarHistogram   `json:"wire_request_bytes"`
+	WireResponseBytes expvarHistogram   `json:"wire_response_bytes"`
+}
+
+func (r *ExpvarRecorder) snapshot() any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]expvarProcedure, len(r.procedures))
+	for procedure, m := range r.procedures {
+		out[procedure] = expvarProcedure{
+			Codes:             maps.Clone(m.codes),
+			VTRPCCodes:        maps.Clone(m.vtrpcCodes),
+			RequestMessages:   m.requestMessages,
+			ResponseMessages:  m.responseMessages,
+			InFlight:          m.inFlight,
+			Latency:           expvarHistogramOf(m.latency),
+			ServerTiming:      expvarHistogramOf(m.serverTiming),
+			RequestBytes:      expvarHistogramOf(m.requestBytes),
+			ResponseBytes:     expvarHistogramOf(m.responseBytes),
+			WireRequestBytes:  expvarHistogramOf(m.wireRequestBytes),
+			WireResponseBytes: expvarHistogramOf(m.wireResponseBytes),
+		}
+	}
+	return out
+}
+
+// expvarHistogramOf reports cumulative buckets, keyed by upper bound.
+func expvarHistogramOf(h *histogram) expvarHistogram {
+	out := expvarHistogram{Buckets: make(map[string]uint64, len(h.counts)), Sum: h.sum, Count: h.count}
+	var total uint64
+	for i, n := range h.counts {
+		total += n
+		out.Buckets[bucketLabel(h, i)] = total
+	}
+	return out
+}
+
+func bucketLabel(h *histogram, i int) string {
+	if i == len(h.bounds) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+}
+
+// PrometheusRecorder is a Recorder that serves its metrics in the
+// Prometheus text exposition format.
+type PrometheusRecorder struct {
+	*metricsSet
+}
+
+func NewPrometheusRecorder() *PrometheusRecorder {
+	return &PrometheusRecorder{newMetricsSet()}
+}
+
+func (r *PrometheusRecorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WriteText(w)
+}
+
+// WriteText writes every metric to w, in the Prometheus text format.
+func (r *PrometheusRecorder) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	procedures := make([]string, 0, len(r.procedures))
+	for procedure := range r.procedures {
+		procedures = append(procedures, procedure)
+	}
+	slices.Sort(procedures)
+
+	bw := bufio.NewWriter(w)
+	counters := func(name, help string, values func(*procedureMetrics) map[string]uint64) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, procedure := range procedures {
+			byCode := values(r.procedures[procedure])
+			codes := make([]string, 0, len(byCode))
+			for code := range byCode {
+				codes = append(codes, code)
+			}
+			slices.Sort(codes)
+			for _, code := range codes {
+				fmt.Fprintf(bw, "%s{procedure=%s,code=%s} %d\n", name, quoteLabel(procedure), quoteLabel(code), byCode[code])
+			}
+		}
+	}
+	scalar := func(name, typ, help string, value func(*procedureMetrics) string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, procedure := range procedures {
+			fmt.Fprintf(bw, "%s{procedure=%s} %s\n", name, quoteLabel(procedure), value(r.procedures[procedure]))
+		}
+	}
+	histograms := func(name, help string, value func(*procedureMetrics) *histogram) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+		for _, procedure := range procedures {
+			h := value(r.procedures[procedure])
+			label := quoteLabel(procedure)
+			var total uint64
+			for i, n := range h.counts {
+				total += n
+				fmt.Fprintf(bw, "%s_bucket{procedure=%s,le=%q} %d\n", name, label, bucketLabel(h, i), total)
+			}
+			fmt.Fprintf(bw, "%s_sum{procedure=%s} %s\n", name, label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+			fmt.Fprintf(bw, "%s_count{procedure=%s} %d\n", name, label, h.count)
+		}
+	}
+
+	counters("psdb_client_calls_total", "Calls by procedure and status code.",
+		func(m *procedureMetrics) map[string]uint64 { return m.codes })
+	counters("psdb_client_vtrpc_errors_total", "RPCErrors in responses by procedure and vtrpc code.",
+		func(m *procedureMetrics) map[string]uint64 { return m.vtrpcCodes })
+	scalar("psdb_client_request_messages_total", "counter", "Request messages sent.",
+		func(m *procedureMetrics) string { return strconv.FormatUint(m.requestMessages, 10) })
+	scalar("psdb_client_response_messages_total", "counter", "Response messages received.",
+		func(m *procedureMetrics) string { return strconv.FormatUint(m.responseMessages, 10) })
+	scalar("psdb_client_streams_in_flight", "gauge", "Streaming calls in progress.",
+		func(m *procedureMetrics) string { return strconv.FormatInt(m.inFlight, 10) })
+	histograms("psdb_client_latency_seconds", "Call latency measured by the client.",
+		func(m *procedureMetrics) *histogram { return m.latency })
+	histograms("psdb_client_server_timing_seconds", "Call latency reported by the server.",
+		func(m *procedureMetrics) *histogram { return m.serverTiming })
+	histograms("psdb_client_request_bytes", "Uncompressed request size.",
+		func(m *procedureMetrics) *histogram { return m.requestBytes })
+	histograms("psdb_client_response_bytes", "Uncompressed response size.",
+		func(m *procedureMetrics) *histogram { return m.responseBytes })
+	histograms("psdb_client_wire_request_bytes", "Request body size on the wire.",
+		func(m *procedureMetrics) *histogram { return m.wireRequestBytes })
+	histograms("psdb_client_wire_response_bytes", "Response body size on the wire.",
+		func(m *procedureMetrics) *histogram { return m.wireResponseBytes })
+	return bw.Flush()
+}
+
+func quoteLabel(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(v) + `"`
+}
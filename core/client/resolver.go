@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/planetscale/psdb/auth"
+)
+
+// Resolver finds the addresses, as host:port, behind a name.
+type Resolver interface {
+	// Resolve returns the addresses in order of preference, and how long
+	// they can be used before resolving again. A TTL of zero or less means
+	// they never change.
+	Resolve(ctx context.Context) (addrs []string, ttl time.Duration, err error)
+}
+
+// StaticResolver always resolves to addrs.
+func StaticResolver(addrs ...string) Resolver {
+	return staticResolver(addrs)
+}
+
+type staticResolver []string
+
+func (r staticResolver) Resolve(context.Context) ([]string, time.Duration, error) {
+	return slices.Clone(r), 0, nil
+}
+
+const defaultSRVTTL = 30 * time.Second
+
+// SRVResolver resolves the DNS SRV records _service._proto.name, ordered
+// by priority, and randomized by weight within a priority.
+type SRVResolver struct {
+	Service, Proto, Name string
+	// TTL is how long the records are used for. The Go resolver doesn't
+	// expose the TTL of the records themselves. Zero means 30 seconds.
+	TTL time.Duration
+	// Resolver defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+
+	// lookupSRV replaces Resolver.LookupSRV in tests
+	lookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+func (r *SRVResolver) Resolve(ctx context.Context) ([]string, time.Duration, error) {
+	lookup := r.lookupSRV
+	if lookup == nil {
+		resolver := r.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		lookup = resolver.LookupSRV
+	}
+	_, records, err := lookup(ctx, r.Service, r.Proto, r.Name)
+	if err != nil {
+		return nil, 0, err
+	}
+	addrs := make([]string, len(records))
+	for i, srv := range records {
+		addrs[i] = net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+	}
+	ttl := r.TTL
+	if ttl == 0 {
+		ttl = defaultSRVTTL
+	}
+	return addrs, ttl, nil
+}
+
+// resolveRetryInterval is how soon a failed resolution is retried,
+// while the previous addresses are kept in use.
+const resolveRetryInterval = 5 * time.Second
+
+// Watcher resolves a Resolver again every time its result expires, and
+// reports every change, including a change of order.
+type Watcher struct {
+	resolver Resolver
+	onUpdate func(addrs, removed []string)
+
+	mu    sync.Mutex
+	addrs []string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWatcher resolves r, calls onUpdate with the result, and keeps doing
+// so in the background for every change, until Close. removed lists the
+// addresses that were in the previous result and no longer are.
+func NewWatcher(ctx context.Context, r Resolver, onUpdate func(addrs, removed []string)) (*Watcher, error) {
+	addrs, ttl, err := r.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watcher{
+		resolver: r,
+		onUpdate: onUpdate,
+		addrs:    addrs,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	if onUpdate != nil {
+		onUpdate(slices.Clone(addrs), nil)
+	}
+	go w.watch(ctx, ttl)
+	return w, nil
+}
+
+// Addrs returns the latest addresses.
+func (w *Watcher) Addrs() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.addrs)
+}
+
+// Close stops watching, and waits for any update in progress.
+func (w *Watcher) Close() {
+	w.cancel()
+	<-w.done
+}
+
+func (w *Watcher) watch(ctx context.Context, ttl time.Duration) {
+	defer close(w.done)
+	for ttl > 0 {
+		t := time.NewTimer(ttl)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		addrs, next, err := w.resolver.Resolve(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			ttl = min(ttl, resolveRetryInterval)
+			continue
+		}
+		ttl = next
+
+		w.mu.Lock()
+		prev := w.addrs
+		w.addrs = addrs
+		w.mu.Unlock()
+		if slices.Equal(prev, addrs) || w.onUpdate == nil {
+			continue
+		}
+		var removed []string
+		for _, addr := range prev {
+			if !slices.Contains(addrs, addr) {
+				removed = append(removed, addr)
+			}
+		}
+		w.onUpdate(slices.Clone(addrs), removed)
+	}
+}
+
+// WatchPool releases the entries of pool for addresses that r no longer
+// resolves to. The Watcher's Addrs are the ones to Get from the pool.
+func WatchPool[T any](ctx context.Context, r Resolver, pool *ClientPool[T]) (*Watcher, error) {
+	return NewWatcher(ctx, r, func(_, removed []string) {
+		for _, addr := range removed {
+			pool.Release(addr)
+		}
+	})
+}
+
+// NewResolvingMultiClient is a MultiClient whose endpoints follow r.
+// Close stops following it.
+func NewResolvingMultiClient(
+	ctx context.Context,
+	r Resolver,
+	auth *auth.Authorization,
+	opts ...Option,
+) (*MultiClient, error) {
+	m := NewMultiClient(nil, auth, opts...)
+	w, err := NewWatcher(ctx, r, func(addrs, _ []string) {
+		m.SetAddrs(addrs)
+	})
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	m.watcher = w
+	return m, nil
+}
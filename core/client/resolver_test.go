@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+)
+
+// fakeResolver resolves to whatever addrs are set, or fails with err.
+type fakeResolver struct {
+	mu    sync.Mutex
+	addrs []string
+	ttl   time.Duration
+	err   error
+	calls int
+}
+
+func (r *fakeResolver) set(addrs []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addrs, r.err = addrs, err
+}
+
+func (r *fakeResolver) Resolve(context.Context) ([]string, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+	return append([]string(nil), r.addrs...), r.ttl, nil
+}
+
+type watcherUpdate struct {
+	addrs, removed []string
+}
+
+func TestWatcher(t *testing.T) {
+	r := &fakeResolver{addrs: []string{"a:443", "b:443"}, ttl: 10 * time.Millisecond}
+	updates := make(chan watcherUpdate, 10)
+	w, err := NewWatcher(context.Background(), r, func(addrs, removed []string) {
+		updates <- watcherUpdate{addrs, removed}
+	})
+	require.NoError(t, err)
+	defer w.Close()
+
+	assert.Equal(t, watcherUpdate{addrs: []string{"a:443", "b:443"}}, <-updates)
+
+	// reordering is a change
+	r.set([]string{"b:443", "a:443"}, nil)
+	assert.Equal(t, watcherUpdate{addrs: []string{"b:443", "a:443"}}, <-updates)
+
+	// a failure keeps the previous addresses
+	r.set(nil, errors.New("no such host"))
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, []string{"b:443", "a:443"}, w.Addrs())
+
+	r.set([]string{"c:443", "a:443"}, nil)
+	assert.Equal(t, watcherUpdate{addrs: []string{"c:443", "a:443"}, removed: []string{"b:443"}}, <-updates)
+	assert.Equal(t, []string{"c:443", "a:443"}, w.Addrs())
+	assert.Empty(t, updates)
+}
+
+func TestWatcherStatic(t *testing.T) {
+	w, err := NewWatcher(context.Background(), StaticResolver("a:443"), nil)
+	require.NoError(t, err)
+	w.Close()
+	assert.Equal(t, []string{"a:443"}, w.Addrs())
+
+	_, err = NewWatcher(context.Background(), &fakeResolver{err: errors.New("boom")}, nil)
+	assert.Error(t, err)
+}
+
+func TestWatchPool(t *testing.T) {
+	r := &fakeResolver{addrs: []string{"a:443", "b:443"}, ttl: 10 * time.Millisecond}
+	evictions := &evictionRecorder{}
+	pool := NewUnauthenticatedPool(newTestPoolClient,
+		WithHTTPClient(&fakeHTTPClient{}),
+		WithPoolEvictionCallback(evictions.record),
+	)
+	defer pool.Close()
+
+	w, err := WatchPool(context.Background(), r, pool)
+	require.NoError(t, err)
+	defer w.Close()
+	for _, addr := range w.Addrs() {
+		pool.Get(addr)
+	}
+	assert.Equal(t, 2, pool.Len())
+
+	r.set([]string{"a:443"}, nil)
+	assert.Eventually(t, func() bool { return pool.Len() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []testEviction{{"b:443", EvictReleased}}, evictions.get())
+}
+
+func TestResolvingMultiClient(t *testing.T) {
+	a, b := &fakeDatabase{name: "a"}, &fakeDatabase{name: "b"}
+	addrs, opts := newMultiTestServers(t, a, b)
+	r := &fakeResolver{addrs: addrs[:1], ttl: 10 * time.Millisecond}
+	multi, err := NewResolvingMultiClient(context.Background(), r, auth.NewBasicAuth("user", "pass"), opts...)
+	require.NoError(t, err)
+	defer multi.Close()
+	ctx := context.Background()
+
+	conn, err := NewConn(ctx, multi)
+	require.NoError(t, err)
+	assert.Equal(t, "a1", string(conn.Signature()))
+
+	r.set(addrs[1:], nil)
+	assert.Eventually(t, func() bool {
+		endpoints := multi.Endpoints()
+		return len(endpoints) == 1 && endpoints[0].Addr == addrs[1]
+	}, time.Second, 5*time.Millisecond)
+
+	conn2, err := NewConn(ctx, multi)
+	require.NoError(t, err)
+	assert.Equal(t, "b1", string(conn2.Signature()))
+	// the session from before the change stays where it was
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"select 1"}, a.queries)
+}
+
+func TestSRVResolver(t *testing.T) {
+	r := &SRVResolver{
+		Service: "psdb",
+		Proto:   "tcp",
+		Name:    "example.com",
+		lookupSRV: func(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			assert.Equal(t, []string{"psdb", "tcp", "example.com"}, []string{service, proto, name})
+			return "_psdb._tcp.example.com.", []*net.SRV{
+				{Target: "edge-1.example.com.", Port: 443, Priority: 10},
+				{Target: "edge-2.example.com.", Port: 8443, Priority: 20},
+			}, nil
+		},
+	}
+	addrs, ttl, err := r.Resolve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"edge-1.example.com:443", "edge-2.example.com:8443"}, addrs)
+	assert.Equal(t, 30*time.Second, ttl)
+}
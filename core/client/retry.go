@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+// RetryFunc decides whether a failed call to procedure may be sent again.
+// msg is the request message, and sent is false when the request is known
+// to have never reached the server.
+type RetryFunc func(procedure string, msg any, sent bool, err error) bool
+
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. Every later retry
+	// waits Multiplier times longer, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of each backoff that is randomized.
+	Jitter float64
+	// Budget, if set, is shared between calls and stops retries
+	// once too many calls are failing.
+	Budget *RetryBudget
+	// Procedures overrides the decision for individual procedures,
+	// keyed by their full name, e.g. psdbv1alpha1connect.DatabaseExecuteProcedure.
+	// Procedures not listed use DefaultRetryFunc.
+	Procedures map[string]RetryFunc
+}
+
+// DefaultRetryPolicy makes up to 3 attempts, starting with a 50ms
+// backoff, with a budget allowing roughly one retry per 10 successes.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 50 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Budget:         NewRetryBudget(10, 0.1),
+	}
+}
+
+func (p *RetryPolicy) shouldRetry(procedure string, msg any, sent bool, err error) bool {
+	if fn, ok := p.Procedures[procedure]; ok {
+		return fn(procedure, msg, sent, err)
+	}
+	return DefaultRetryFunc(procedure, msg, sent, err)
+}
+
+// backoff returns the delay before the given retry, counting from 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 {
+		d = math.Min(d, float64(p.MaxBackoff))
+	}
+	d -= d * p.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// DefaultRetryFunc only ever retries transient failures, and only when
+// doing so can't apply a statement twice:
+//
+//   - CreateSession is always retried.
+//   - Execute and StreamExecute are retried when the session is not in a
+//     transaction, and either the statement is read only or the request
+//     was never sent.
+//   - Prepare is retried when the session is not in a transaction.
+//   - Sync is retried, since it only reads.
+//   - Anything else is retried only if the request was never sent.
+//
+// Streams are never retried once a message has been received.
+func DefaultRetryFunc(procedure string, msg any, sent bool, err error) bool {
+	if !isTransient(err) {
+		return false
+	}
+	switch procedure {
+	case psdbv1alpha1connect.DatabaseCreateSessionProcedure:
+		return true
+	case psdbv1alpha1connect.DatabaseExecuteProcedure,
+		psdbv1alpha1connect.DatabaseStreamExecuteProcedure:
+		req, ok := msg.(*psdbv1alpha1.ExecuteRequest)
+		if !ok || req.GetSession().GetVitessSession().GetInTransaction() {
+			return false
+		}
+		return !sent || isReadOnlyQuery(req.GetQuery())
+	case psdbv1alpha1connect.DatabasePrepareProcedure:
+		req, ok := msg.(*psdbv1alpha1.PrepareRequest)
+		return ok && !req.GetSession().GetVitessSession().GetInTransaction()
+	case syncProcedure:
+		return true
+	}
+	return !sent
+}
+
+// syncProcedure is psdbconnectv1alpha1connect.ConnectSyncProcedure,
+// spelled out to keep from depending on the Connect service here.
+const syncProcedure = "/psdbconnect.v1alpha1.Connect/Sync"
+
+// isTransient reports whether err may go away on its own. An open circuit
+// breaker doesn't go away before the next attempt would be made.
+func isTransient(err error) bool {
+	return connect.CodeOf(err) == connect.CodeUnavailable && !errors.Is(err, ErrCircuitOpen)
+}
+
+// wasSent reports whether a failed request may have reached the server.
+func wasSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return false
+	}
+	// the server refused the stream before processing it
+	return !strings.Contains(err.Error(), "REFUSED_STREAM")
+}
+
+// RetryBudget is a token bucket limiting retries to a fraction of
+// successful calls. Every failure that would be retried takes a token,
+// every success returns tokenRatio of one, and retries are only allowed
+// while more than half of the tokens are left.
+type RetryBudget struct {
+	mu         sync.Mutex
+	tokens     float64
+	maxTokens  float64
+	tokenRatio float64
+}
+
+func NewRetryBudget(maxTokens, tokenRatio float64) *RetryBudget {
+	return &RetryBudget{
+		tokens:     maxTokens,
+		maxTokens:  maxTokens,
+		tokenRatio: tokenRatio,
+	}
+}
+
+func (b *RetryBudget) onSuccess() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.tokens = math.Min(b.maxTokens, b.tokens+b.tokenRatio)
+	b.mu.Unlock()
+}
+
+// onFailure takes a token, and reports whether a retry is allowed.
+func (b *RetryBudget) onFailure() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Max(0, b.tokens-1)
+	return b.tokens > b.maxTokens/2
+}
+
+type retryInterceptor struct {
+	policy *RetryPolicy
+}
+
+func newRetryInterceptor(policy *RetryPolicy) *retryInterceptor {
+	if policy == nil {
+		policy = DefaultRetryPolicy()
+	}
+	return &retryInterceptor{policy}
+}
+
+// retry reports whether attempt, which failed with err, should be
+// retried, and waits out the backoff if so.
+func (i *retryInterceptor) retry(ctx context.Context, attempt int, procedure string, msg any, err error) bool {
+	// only failures that would be retried take from the budget
+	if attempt >= i.policy.MaxAttempts ||
+		!i.policy.shouldRetry(procedure, msg, wasSent(err), err) ||
+		!i.policy.Budget.onFailure() {
+		return false
+	}
+	t := time.NewTimer(i.policy.backoff(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (i *retryInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		for attempt := 1; ; attempt++ {
+			res, err := next(ctx, req)
+			if err == nil {
+				i.policy.Budget.onSuccess()
+				return res, nil
+			}
+			if !i.retry(ctx, attempt, req.Spec().Procedure, req.Any(), err) {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (i *retryInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		// only a server stream has a single request
+		// message that can be sent again
+		if spec.StreamType != connect.StreamTypeServer {
+			return conn
+		}
+		return &retryingStreamConn{
+			StreamingClientConn: conn,
+			ctx:                 ctx,
+			next:                next,
+			interceptor:         i,
+		}
+	}
+}
+
+func (*retryInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// retryingStreamConn starts a server stream over if it fails before
+// the first message is received.
+type retryingStreamConn struct {
+	connect.StreamingClientConn
+
+	ctx         context.Context
+	next        connect.StreamingClientFunc
+	interceptor *retryInterceptor
+
+	msg      any
+	attempt  int
+	received bool
+}
+
+func (c *retryingStreamConn) Send(msg any) error {
+	c.msg = msg
+	c.attempt = 1
+	return c.StreamingClientConn.Send(msg)
+}
+
+func (c *retryingStreamConn) Receive(msg any) error {
+	for {
+		err := c.StreamingClientConn.Receive(msg)
+		if err == nil {
+			if !c.received {
+				c.received = true
+				c.interceptor.policy.Budget.onSuccess()
+			}
+			return nil
+		}
+		if c.received || c.msg == nil || errors.Is(err, io.EOF) ||
+			!c.interceptor.retry(c.ctx, c.attempt, c.Spec().Procedure, c.msg, err) {
+			return err
+		}
+		if err := c.restart(); err != nil {
+			return err
+		}
+	}
+}
+
+// restart replaces the failed stream with a new one, with the same
+// request headers and message.
+func (c *retryingStreamConn) restart() error {
+	_ = c.StreamingClientConn.CloseResponse()
+	conn := c.next(c.ctx, c.Spec())
+	for k, v := range c.StreamingClientConn.RequestHeader() {
+		conn.RequestHeader()[k] = v
+	}
+	c.StreamingClientConn = conn
+	c.attempt++
+	if err := conn.Send(c.msg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return conn.CloseRequest()
+}
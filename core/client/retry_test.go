@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	vtgatepb "github.com/planetscale/vitess-types/gen/vitess/vtgate/v22"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+func testRetryPolicy() *RetryPolicy {
+	p := DefaultRetryPolicy()
+	p.InitialBackoff = time.Millisecond
+	p.Budget = nil
+	return p
+}
+
+func TestRetry(t *testing.T) {
+	db := &fakeDatabase{failures: map[string]int{
+		psdbv1alpha1connect.DatabaseCreateSessionProcedure: 2,
+	}}
+	addr, opts := newTestServer(t, db)
+	opts = append(opts, WithRetryPolicy(testRetryPolicy()))
+	ctx := context.Background()
+
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), opts...)
+	require.NoError(t, err)
+	assert.Equal(t, 3, db.attemptsOf(psdbv1alpha1connect.DatabaseCreateSessionProcedure))
+
+	// a read that reached the server is retried
+	db.failures[psdbv1alpha1connect.DatabaseExecuteProcedure] = 1
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, db.attemptsOf(psdbv1alpha1connect.DatabaseExecuteProcedure))
+
+	// a write that reached the server is not
+	db.failures[psdbv1alpha1connect.DatabaseExecuteProcedure] = 1
+	_, err = conn.Execute(ctx, "insert into t values (1)", nil)
+	assert.Equal(t, connect.CodeUnavailable, connect.CodeOf(err))
+	assert.Equal(t, 3, db.attemptsOf(psdbv1alpha1connect.DatabaseExecuteProcedure))
+
+	// nor is a read inside a transaction
+	_, err = conn.Execute(ctx, "begin", nil)
+	require.NoError(t, err)
+	db.failures[psdbv1alpha1connect.DatabaseExecuteProcedure] = 1
+	_, err = conn.Execute(ctx, "select 1", nil)
+	assert.Equal(t, connect.CodeUnavailable, connect.CodeOf(err))
+	assert.Equal(t, 5, db.attemptsOf(psdbv1alpha1connect.DatabaseExecuteProcedure))
+	_, err = conn.Execute(ctx, "rollback", nil)
+	require.NoError(t, err)
+
+	// a stream that failed before its first message is retried
+	db.failures[psdbv1alpha1connect.DatabaseStreamExecuteProcedure] = 1
+	stream, err := conn.StreamExecute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	n := 0
+	for stream.Receive() {
+		n++
+	}
+	require.NoError(t, stream.Err())
+	require.NoError(t, stream.Close())
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 2, db.attemptsOf(psdbv1alpha1connect.DatabaseStreamExecuteProcedure))
+	assert.Equal(t, "Basic dXNlcjpwYXNz", db.headers[len(db.headers)-1].Get("Authorization"))
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	db := &fakeDatabase{failures: map[string]int{
+		psdbv1alpha1connect.DatabaseCreateSessionProcedure: 5,
+	}}
+	addr, opts := newTestServer(t, db)
+	opts = append(opts, WithRetryPolicy(testRetryPolicy()))
+
+	_, err := Dial(context.Background(), addr, auth.NewBasicAuth("user", "pass"), opts...)
+	assert.Equal(t, connect.CodeUnavailable, connect.CodeOf(err))
+	assert.Equal(t, 3, db.attemptsOf(psdbv1alpha1connect.DatabaseCreateSessionProcedure))
+}
+
+func TestDefaultRetryFunc(t *testing.T) {
+	unavailable := connect.NewError(connect.CodeUnavailable, errors.New("boom"))
+	execute := func(query string, inTx bool) *psdbv1alpha1.ExecuteRequest {
+		return &psdbv1alpha1.ExecuteRequest{
+			Query: query,
+			Session: &psdbv1alpha1.Session{
+				VitessSession: &vtgatepb.Session{InTransaction: inTx},
+			},
+		}
+	}
+	cases := []struct {
+		procedure string
+		msg       any
+		sent      bool
+		err       error
+		retry     bool
+	}{
+		{psdbv1alpha1connect.DatabaseCreateSessionProcedure, &psdbv1alpha1.CreateSessionRequest{}, true, unavailable, true},
+		{psdbv1alpha1connect.DatabaseCreateSessionProcedure, &psdbv1alpha1.CreateSessionRequest{}, true, connect.NewError(connect.CodeUnauthenticated, nil), false},
+		{psdbv1alpha1connect.DatabaseExecuteProcedure, execute("select 1", false), true, unavailable, true},
+		{psdbv1alpha1connect.DatabaseExecuteProcedure, execute("/* x */ (select 1)", false), true, unavailable, true},
+		{psdbv1alpha1connect.DatabaseExecuteProcedure, execute("select 1;\n", false), true, unavailable, true},
+		{psdbv1alpha1connect.DatabaseExecuteProcedure, execute("select 1; delete from t", false), true, unavailable, false},
+		{psdbv1alpha1connect.DatabaseExecuteProcedure, execute("select 1 for update", false), true, unavailable, false},
+		{psdbv1alpha1connect.DatabaseExecuteProcedure, execute("update t set a = 1", false), true, unavailable, false},
+		{psdbv1alpha1connect.DatabaseExecuteProcedure, execute("update t set a = 1", false), false, unavailable, true},
+		{psdbv1alpha1connect.DatabaseExecuteProcedure, execute("select 1", true), false, unavailable, false},
+		{psdbv1alpha1connect.DatabaseStreamExecuteProcedure, execute("select 1", false), true, unavailable, true},
+		{psdbv1alpha1connect.DatabaseCloseSessionProcedure, &psdbv1alpha1.CloseSessionRequest{}, true, unavailable, false},
+		{psdbv1alpha1connect.DatabaseCloseSessionProcedure, &psdbv1alpha1.CloseSessionRequest{}, false, unavailable, true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.retry, DefaultRetryFunc(c.procedure, c.msg, c.sent, c.err), "%s %v", c.procedure, c.msg)
+	}
+}
+
+func TestWasSent(t *testing.T) {
+	dialErr := connect.NewError(connect.CodeUnavailable, &net.OpError{Op: "dial", Err: errors.New("connection refused")})
+	assert.False(t, wasSent(dialErr))
+	assert.False(t, wasSent(connect.NewError(connect.CodeUnavailable, errors.New("stream error: stream ID 3; REFUSED_STREAM"))))
+	assert.True(t, wasSent(connect.NewError(connect.CodeUnavailable, errors.New("unexpected EOF"))))
+}
+
+func TestRetryBudgetOnlyRetriedFailures(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	policy := testRetryPolicy()
+	policy.Budget = NewRetryBudget(4, 0.1)
+	ctx := context.Background()
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), append(opts, WithRetryPolicy(policy))...)
+	require.NoError(t, err)
+
+	// writes that reached the server aren't retried, and leave the budget alone
+	for range 5 {
+		db.failures = map[string]int{psdbv1alpha1connect.DatabaseExecuteProcedure: 1}
+		_, err = conn.Execute(ctx, "insert into t values (1)", nil)
+		assert.Equal(t, connect.CodeUnavailable, connect.CodeOf(err))
+	}
+	db.failures = map[string]int{psdbv1alpha1connect.DatabaseExecuteProcedure: 1}
+	_, err = conn.Execute(ctx, "select 1", nil)
+	assert.NoError(t, err)
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := NewRetryBudget(4, 2)
+	assert.True(t, b.onFailure())
+	assert.False(t, b.onFailure())
+	b.onSuccess()
+	assert.True(t, b.onFailure())
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	compress "github.com/klauspost/connect-compress/v2"
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+	vtgatepb "github.com/planetscale/vitess-types/gen/vitess/vtgate/v22"
+	vtrpcpb "github.com/planetscale/vitess-types/gen/vitess/vtrpc/v22"
+
+	"github.com/planetscale/psdb/core/codec"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+// duplicateMessage is a duplicate key error as vttablet words it, quoting
+// the statement and its bind variables.
+const duplicateMessage = "target: ks.-.primary: vttablet: Duplicate entry 'alice@example.com' for key 'users.email' " +
+	"(errno 1062) (sqlstate 23000) (CallerID: user): " +
+	`Sql: "insert into users(email) values ('alice@example.com')", BindVars: {vtg1: "type:VARCHAR value:\"alice@example.com\""}`
+
+// fakeDatabase is an in-memory Database service. Every response carries
+// a new Session whose signature counts the calls made so far, so tests
+// can check that the latest Session is sent back. Like vtgate, it echoes
+// the transaction state and query timeout of the Session it received.
+type fakeDatabase struct {
+	psdbv1alpha1connect.UnimplementedDatabaseHandler
+
+	// name prefixes signatures, to tell servers apart
+	name string
+
+	mu       sync.Mutex
+	calls    int
+	received []*psdbv1alpha1.Session
+	queries  []string
+	closed   bool
+	headers  []http.Header
+
+	// delay holds up every Execute, and canceled counts
+	// the ones abandoned by the client meanwhile
+	delay    time.Duration
+	canceled int
+
+	// failures is the number of times each procedure
+	// fails with CodeUnavailable before succeeding
+	failures map[string]int
+	attempts map[string]int
+}
+
+func (d *fakeDatabase) injected(procedure string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.attempts == nil {
+		d.attempts = make(map[string]int)
+	}
+	d.attempts[procedure]++
+	if d.failures[procedure] > 0 {
+		d.failures[procedure]--
+		return connect.NewError(connect.CodeUnavailable, errors.New("injected failure"))
+	}
+	return nil
+}
+
+func (d *fakeDatabase) attemptsOf(procedure string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.attempts[procedure]
+}
+
+func (d *fakeDatabase) next(h http.Header, in *psdbv1alpha1.Session) *psdbv1alpha1.Session {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls++
+	d.received = append(d.received, in)
+	d.headers = append(d.headers, h.Clone())
+	return &psdbv1alpha1.Session{
+		Signature: []byte(d.name + strconv.Itoa(d.calls)),
+		VitessSession: &vtgatepb.Session{
+			InTransaction: in.GetVitessSession().GetInTransaction(),
+			QueryTimeout:  in.GetVitessSession().GetQueryTimeout(),
+		},
+	}
+}
+
+func (d *fakeDatabase) CreateSession(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.CreateSessionRequest],
+) (*connect.Response[psdbv1alpha1.CreateSessionResponse], error) {
+	if err := d.injected(psdbv1alpha1connect.DatabaseCreateSessionProcedure); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&psdbv1alpha1.CreateSessionResponse{
+		Session: d.next(req.Header(), nil),
+	}), nil
+}
+
+func (d *fakeDatabase) Execute(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.ExecuteRequest],
+) (*connect.Response[psdbv1alpha1.ExecuteResponse], error) {
+	if err := d.injected(psdbv1alpha1connect.DatabaseExecuteProcedure); err != nil {
+		return nil, err
+	}
+	if d.delay > 0 {
+		select {
+		case <-ctx.Done():
+			d.mu.Lock()
+			d.canceled++
+			d.mu.Unlock()
+			return nil, ctx.Err()
+		case <-time.After(d.delay):
+		}
+	}
+	session := d.next(req.Header(), req.Msg.Session)
+	d.mu.Lock()
+	d.queries = append(d.queries, req.Msg.Query)
+	d.mu.Unlock()
+	switch req.Msg.Query {
+	case "sleep":
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	case "begin":
+		session.VitessSession.InTransaction = true
+	case "commit", "rollback":
+		session.VitessSession.InTransaction = false
+	case "error":
+		return nil, connect.NewError(connect.CodeAlreadyExists, errors.New(duplicateMessage))
+	case "syntax error":
+		// vtgate leaves out the Session when a statement fails to parse
+		return connect.NewResponse(&psdbv1alpha1.ExecuteResponse{
+			Error: &vtrpcpb.RPCError{Code: vtrpcpb.Code_INVALID_ARGUMENT, Message: "syntax error"},
+		}), nil
+	case "duplicate":
+		return connect.NewResponse(&psdbv1alpha1.ExecuteResponse{
+			Session: session,
+			Error: &vtrpcpb.RPCError{
+				Code:    vtrpcpb.Code_ALREADY_EXISTS,
+				Message: duplicateMessage,
+			},
+		}), nil
+	}
+	return connect.NewResponse(&psdbv1alpha1.ExecuteResponse{
+		Session: session,
+		Result:  &querypb.QueryResult{RowsAffected: 1},
+		Timing:  0.001,
+	}), nil
+}
+
+func (d *fakeDatabase) StreamExecute(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.ExecuteRequest],
+	stream *connect.ServerStream[psdbv1alpha1.ExecuteResponse],
+) error {
+	if err := d.injected(psdbv1alpha1connect.DatabaseStreamExecuteProcedure); err != nil {
+		return err
+	}
+	if req.Msg.Query == "stall" {
+		// one message, then nothing until the client gives up
+		if err := stream.Send(&psdbv1alpha1.ExecuteResponse{
+			Session: d.next(req.Header(), req.Msg.Session),
+		}); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	for i := 0; i < 3; i++ {
+		if err := stream.Send(&psdbv1alpha1.ExecuteResponse{
+			Session: d.next(req.Header(), req.Msg.Session),
+			Result:  &querypb.QueryResult{Rows: []*querypb.Row{{}, {}}},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *fakeDatabase) Prepare(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.PrepareRequest],
+) (*connect.Response[psdbv1alpha1.PrepareResponse], error) {
+	if err := d.injected(psdbv1alpha1connect.DatabasePrepareProcedure); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&psdbv1alpha1.PrepareResponse{
+		Session: d.next(req.Header(), req.Msg.Session),
+	}), nil
+}
+
+func (d *fakeDatabase) CloseSession(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.CloseSessionRequest],
+) (*connect.Response[psdbv1alpha1.CloseSessionResponse], error) {
+	if err := d.injected(psdbv1alpha1connect.DatabaseCloseSessionProcedure); err != nil {
+		return nil, err
+	}
+	session := d.next(req.Header(), req.Msg.Session)
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	return connect.NewResponse(&psdbv1alpha1.CloseSessionResponse{
+		Session: session,
+	}), nil
+}
+
+func (d *fakeDatabase) lastReceived() *psdbv1alpha1.Session {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.received[len(d.received)-1]
+}
+
+// newTestServer starts an HTTP/2 TLS server for h, and returns its
+// address along with Options that trust it.
+func newTestServer(t testing.TB, h psdbv1alpha1connect.DatabaseHandler) (string, []Option) {
+	t.Helper()
+	srv := newTLSTestServer(t, h)
+	return srv.Listener.Addr().String(), []Option{WithHTTPClient(srv.Client())}
+}
+
+// newTLSTestServer starts an HTTP/2 TLS server for h.
+func newTLSTestServer(t testing.TB, h psdbv1alpha1connect.DatabaseHandler) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle(psdbv1alpha1connect.NewDatabaseHandler(h,
+		compress.WithAll(compress.LevelFastest),
+		connect.WithCodec(codec.DefaultCodec),
+	))
+	srv := httptest.NewUnstartedServer(mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
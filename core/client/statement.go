@@ -0,0 +1,219 @@
+package client
+
+import (
+	"strconv"
+	"strings"
+)
+
+// readOnlyVerbs are statements that never write, and so are safe to send
+// more than once.
+var readOnlyVerbs = []string{"select", "show", "describe", "desc", "explain"}
+
+// isReadOnlyQuery reports whether query is a statement that doesn't write.
+// Anything it can't classify is assumed to be a write.
+func isReadOnlyQuery(query string) bool {
+	// a read may be followed by a write in the same text,
+	// so anything but a single statement is not read only
+	if strings.Contains(strings.TrimRight(query, " \t\r\n;"), ";") {
+		return false
+	}
+	verb := strings.ToLower(firstWord(query))
+	for _, v := range readOnlyVerbs {
+		if verb == v {
+			// locking reads only make sense inside a transaction,
+			// treat them like the writes that usually follow
+			lower := strings.ToLower(query)
+			return !strings.Contains(lower, " for update") &&
+				!strings.Contains(lower, " for share") &&
+				!strings.Contains(lower, " lock in share mode") &&
+				!strings.Contains(lower, " into ")
+		}
+	}
+	return false
+}
+
+// firstWord returns the first keyword of query, skipping whitespace,
+// comments and opening parentheses.
+func firstWord(query string) string {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return ""
+			}
+			query = query[end+2:]
+		case strings.HasPrefix(query, "-- "), strings.HasPrefix(query, "#"):
+			end := strings.IndexByte(query, '\n')
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+		default:
+			end := strings.IndexAny(query, " \t\r\n(;")
+			if end < 0 {
+				return query
+			}
+			return query[:end]
+		}
+	}
+}
+
+// normalizeQuery replaces the literals in query with ?, and collapses
+// whitespace and comments, so that queries differing only in their values
+// look the same and don't leak those values.
+func normalizeQuery(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	space := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			i = skipLiteral(query, i)
+			c = '?'
+		case c == '`':
+			end := skipLiteral(query, i)
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteString(query[i:end])
+			i = end
+			continue
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+			space = b.Len() > 0
+			continue
+		case strings.HasPrefix(query[i:], "-- "), c == '#':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			space = b.Len() > 0
+			i++
+			continue
+		case isDigit(c) && (i == 0 || !isIdentByte(query[i-1])):
+			for i < len(query) && (isIdentByte(query[i]) || query[i] == '.') {
+				i++
+			}
+			c = '?'
+		default:
+			i++
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// redactErrorMessage hides the values vttablet quotes in its error
+// messages. The statement after "Sql: " is normalized unless rawQuery, and
+// the bind variables after "BindVars: ", along with the entry of a
+// duplicate key error, are dropped unless bindVarValues.
+func redactErrorMessage(msg string, rawQuery, bindVarValues bool) string {
+	if !rawQuery {
+		msg = replaceAfter(msg, `Sql: "`, func(rest string) (string, int) {
+			end := skipLiteral(rest, 0)
+			query, err := strconv.Unquote(rest[:end])
+			if err != nil {
+				query = strings.Trim(rest[:end], `"`)
+			}
+			return strconv.Quote(normalizeQuery(query)), end
+		})
+	}
+	if !bindVarValues {
+		msg = replaceAfter(msg, "BindVars: {", func(rest string) (string, int) {
+			return "{[redacted]}", skipBraces(rest)
+		})
+		msg = replaceAfter(msg, "Duplicate entry '", func(rest string) (string, int) {
+			return "'?'", skipLiteral(rest, 0)
+		})
+	}
+	return msg
+}
+
+// replaceAfter replaces, after every occurrence of prefix, the text that
+// starts with the prefix's last byte. fn returns the replacement, and the
+// length of the text it replaces.
+func replaceAfter(msg, prefix string, fn func(rest string) (string, int)) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(msg, prefix)
+		if i < 0 {
+			break
+		}
+		start := i + len(prefix) - 1
+		repl, n := fn(msg[start:])
+		b.WriteString(msg[:start])
+		b.WriteString(repl)
+		msg = msg[start+n:]
+	}
+	if b.Len() == 0 {
+		return msg
+	}
+	b.WriteString(msg)
+	return b.String()
+}
+
+// skipBraces returns the index just past the braces that s starts with,
+// skipping over quoted strings inside.
+func skipBraces(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case '"', '\'':
+			i = skipLiteral(s, i) - 1
+		}
+	}
+	return len(s)
+}
+
+// skipLiteral returns the index just past the quoted literal starting at i,
+// honouring doubled and backslash escaped quotes.
+func skipLiteral(query string, i int) int {
+	quote := query[i]
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$'
+}
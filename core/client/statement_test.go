@@ -0,0 +1,34 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	for _, tt := range []struct {
+		query, want string
+	}{
+		{"select 1", "select ?"},
+		{"select * from t1 where id = 42", "select * from t1 where id = ?"},
+		{"select 'it''s', \"a\\\"b\", 1.5e3", "select ?, ?, ?"},
+		{"  select\n\t`col 1`  from t  ", "select `col 1` from t"},
+		{"/* hint */ select a -- trailing\nfrom t # more", "select a from t"},
+		{"insert into t values (1, 'x'), (2, 'y')", "insert into t values (?, ?), (?, ?)"},
+		{"select 'unterminated", "select ?"},
+	} {
+		assert.Equal(t, tt.want, normalizeQuery(tt.query), tt.query)
+	}
+}
+
+func TestRedactErrorMessage(t *testing.T) {
+	assert.Equal(t,
+		"target: ks.-.primary: vttablet: Duplicate entry '?' for key 'users.email' (errno 1062) (sqlstate 23000) (CallerID: user): "+
+			`Sql: "insert into users(email) values (?)", BindVars: {[redacted]}`,
+		redactErrorMessage(duplicateMessage, false, false))
+	assert.Equal(t, duplicateMessage, redactErrorMessage(duplicateMessage, true, true))
+	assert.Equal(t, "no values here", redactErrorMessage("no values here", false, false))
+	// a message cut short doesn't run past its end
+	assert.Equal(t, `Sql: "select ?"`, redactErrorMessage(`Sql: "select 'x`, false, false))
+}
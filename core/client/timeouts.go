@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	vtgatepb "github.com/planetscale/vitess-types/gen/vitess/vtgate/v22"
+	"google.golang.org/protobuf/proto"
+
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+var ErrStreamIdle = errors.New("no message received within the stream idle timeout")
+
+// Timeouts are default deadlines, applied only when the context of a call
+// has no deadline of its own. A zero value disables that default.
+type Timeouts struct {
+	// Session bounds CreateSession and CloseSession.
+	Session time.Duration
+	// Execute bounds Execute and Prepare.
+	Execute time.Duration
+	// StreamIdle bounds the wait for each message of a StreamExecute
+	// or Sync stream, rather than the whole stream.
+	StreamIdle time.Duration
+}
+
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Session:    10 * time.Second,
+		Execute:    30 * time.Second,
+		StreamIdle: 2 * time.Minute,
+	}
+}
+
+// WithTimeouts gives calls without a deadline a default one. Whatever the
+// deadline, the time left is sent to the server as the query timeout of
+// the vitess Session, so it gives up on the query when the client does.
+// Deadlines cover every retry when WithTimeouts comes before
+// WithRetryPolicy, and each attempt when it comes after.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(c *config) {
+		c.interceptors = append(c.interceptors, newTimeoutInterceptor(timeouts))
+	}
+}
+
+type timeoutInterceptor struct {
+	timeouts Timeouts
+}
+
+func newTimeoutInterceptor(timeouts Timeouts) *timeoutInterceptor {
+	return &timeoutInterceptor{timeouts: timeouts}
+}
+
+func (i *timeoutInterceptor) unaryTimeout(procedure string) time.Duration {
+	switch procedure {
+	case psdbv1alpha1connect.DatabaseCreateSessionProcedure,
+		psdbv1alpha1connect.DatabaseCloseSessionProcedure:
+		return i.timeouts.Session
+	case psdbv1alpha1connect.DatabaseExecuteProcedure,
+		psdbv1alpha1connect.DatabasePrepareProcedure:
+		return i.timeouts.Execute
+	}
+	return 0
+}
+
+func (i *timeoutInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			if timeout := i.unaryTimeout(req.Spec().Procedure); timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+		}
+		var msg any
+		switch m := req.Any().(type) {
+		case *psdbv1alpha1.ExecuteRequest:
+			msg = withQueryTimeout(ctx, m)
+		case *psdbv1alpha1.PrepareRequest:
+			if session := sessionWithQueryTimeout(ctx, m.GetSession()); session != m.GetSession() {
+				msg = &psdbv1alpha1.PrepareRequest{
+					Session:       session,
+					Query:         m.Query,
+					BindVariables: m.BindVariables,
+				}
+			}
+		}
+		if msg == nil || msg == req.Any() {
+			return next(ctx, req)
+		}
+		res, err := next(ctx, &timeoutRequest{AnyRequest: req, msg: msg})
+		if res != nil {
+			restoreQueryTimeout(res.Any(), req.Any())
+		}
+		return res, err
+	}
+}
+
+// timeoutRequest sends msg in place of the message of the caller's
+// request, which is left as it was.
+type timeoutRequest struct {
+	connect.AnyRequest
+	msg any
+}
+
+func (r *timeoutRequest) Any() any {
+	return r.msg
+}
+
+func (i *timeoutInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		if _, ok := ctx.Deadline(); ok || i.timeouts.StreamIdle <= 0 {
+			return &timeoutStreamConn{StreamingClientConn: next(ctx, spec), ctx: ctx}
+		}
+		ctx, cancel := context.WithCancelCause(ctx)
+		c := &timeoutStreamConn{ctx: ctx, cancel: cancel, idle: i.timeouts.StreamIdle}
+		c.timer = time.AfterFunc(c.idle, func() { cancel(ErrStreamIdle) })
+		c.StreamingClientConn = next(ctx, spec)
+		return c
+	}
+}
+
+func (*timeoutInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// timeoutStreamConn passes the deadline of a stream on as a query timeout,
+// or cancels the stream when no message arrives for too long.
+type timeoutStreamConn struct {
+	connect.StreamingClientConn
+	ctx  context.Context
+	sent any // the caller's request, once it had a query timeout added
+
+	// the rest is only set with an idle timeout
+	idle     time.Duration
+	timer    *time.Timer
+	cancel   context.CancelCauseFunc
+	stopOnce sync.Once
+}
+
+func (c *timeoutStreamConn) Send(msg any) error {
+	if m, ok := msg.(*psdbv1alpha1.ExecuteRequest); ok {
+		if withTimeout := withQueryTimeout(c.ctx, m); withTimeout != m {
+			c.sent = m
+			msg = withTimeout
+		}
+	}
+	return c.StreamingClientConn.Send(msg)
+}
+
+func (c *timeoutStreamConn) Receive(msg any) error {
+	err := c.StreamingClientConn.Receive(msg)
+	if err == nil && c.sent != nil {
+		restoreQueryTimeout(msg, c.sent)
+	}
+	if c.timer == nil {
+		return err
+	}
+	if err != nil {
+		c.stop()
+		if errors.Is(context.Cause(c.ctx), ErrStreamIdle) {
+			return connect.NewError(connect.CodeDeadlineExceeded, ErrStreamIdle)
+		}
+		return err
+	}
+	c.timer.Reset(c.idle)
+	return nil
+}
+
+func (c *timeoutStreamConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	if c.timer != nil {
+		c.stop()
+	}
+	return err
+}
+
+func (c *timeoutStreamConn) stop() {
+	c.stopOnce.Do(func() {
+		c.timer.Stop()
+		c.cancel(context.Canceled)
+	})
+}
+
+// withQueryTimeout returns msg with the time left before the deadline of
+// ctx as its query timeout, copying it rather than changing the caller's.
+func withQueryTimeout(ctx context.Context, msg *psdbv1alpha1.ExecuteRequest) *psdbv1alpha1.ExecuteRequest {
+	session := sessionWithQueryTimeout(ctx, msg.GetSession())
+	if session == msg.GetSession() {
+		return msg
+	}
+	return &psdbv1alpha1.ExecuteRequest{
+		Session:       session,
+		Query:         msg.Query,
+		BindVariables: msg.BindVariables,
+		Prepared:      msg.Prepared,
+	}
+}
+
+// sessionWithQueryTimeout returns a copy of session with its QueryTimeout,
+// in milliseconds, lowered to the time left before the deadline of ctx.
+// It returns session itself when there is nothing to change.
+func sessionWithQueryTimeout(ctx context.Context, session *psdbv1alpha1.Session) *psdbv1alpha1.Session {
+	deadline, ok := ctx.Deadline()
+	if !ok || session == nil {
+		return session
+	}
+	ms := time.Until(deadline).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	if current := session.GetVitessSession().GetQueryTimeout(); current > 0 && current <= ms {
+		return session
+	}
+	session = proto.Clone(session).(*psdbv1alpha1.Session)
+	if session.VitessSession == nil {
+		session.VitessSession = &vtgatepb.Session{}
+	}
+	session.VitessSession.QueryTimeout = ms
+	return session
+}
+
+// restoreQueryTimeout gives the Session of res the query timeout of the
+// Session in req, undoing the one added for the call. The server echoes
+// the Session back, and the Conn keeps it, so the timeout would otherwise
+// cap every later call, whatever its deadline.
+func restoreQueryTimeout(res, req any) {
+	session := sessionOf(res)
+	if session.GetVitessSession() == nil {
+		return
+	}
+	session.VitessSession.QueryTimeout = sessionOf(req).GetVitessSession().GetQueryTimeout()
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	vtgatepb "github.com/planetscale/vitess-types/gen/vitess/vtgate/v22"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+func TestTimeouts(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	ctx := context.Background()
+
+	timeouts := Timeouts{Session: time.Second, Execute: 5 * time.Second, StreamIdle: 100 * time.Millisecond}
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), append(opts, WithTimeouts(timeouts))...)
+	require.NoError(t, err)
+
+	before := conn.Session()
+	_, err = conn.Execute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	sent := db.lastReceived().GetVitessSession().GetQueryTimeout()
+	assert.Greater(t, sent, int64(4000))
+	assert.LessOrEqual(t, sent, int64(5000))
+	assert.Zero(t, before.GetVitessSession().GetQueryTimeout(), "the Conn's Session must not change")
+	assert.Zero(t, conn.Session().GetVitessSession().GetQueryTimeout(), "nor keep the echoed timeout")
+
+	// the caller's deadline wins over the default
+	long, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+	_, err = conn.Execute(long, "select 1", nil)
+	require.NoError(t, err)
+	assert.Greater(t, db.lastReceived().GetVitessSession().GetQueryTimeout(), int64(5000))
+
+	stream, err := conn.StreamExecute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	for stream.Receive() {
+	}
+	require.NoError(t, stream.Err())
+	assert.Zero(t, db.lastReceived().GetVitessSession().GetQueryTimeout(), "idle timeouts set no deadline")
+}
+
+func TestTimeoutsKeepCallerQueryTimeout(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	ctx := context.Background()
+
+	client := New(addr, psdbv1alpha1connect.NewDatabaseClient, auth.NewBasicAuth("user", "pass"), append(opts, WithTimeouts(DefaultTimeouts()))...)
+	req := connect.NewRequest(&psdbv1alpha1.ExecuteRequest{
+		Session: &psdbv1alpha1.Session{VitessSession: &vtgatepb.Session{QueryTimeout: 2000}},
+		Query:   "select 1",
+	})
+	res, err := client.Execute(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2000), db.lastReceived().GetVitessSession().GetQueryTimeout(), "a lower timeout is kept")
+	assert.Equal(t, int64(2000), res.Msg.GetSession().GetVitessSession().GetQueryTimeout())
+
+	short, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	res, err = client.Execute(short, req)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, db.lastReceived().GetVitessSession().GetQueryTimeout(), int64(1000))
+	assert.Equal(t, int64(2000), res.Msg.GetSession().GetVitessSession().GetQueryTimeout(), "the caller's timeout is restored")
+	assert.Equal(t, int64(2000), req.Msg.GetSession().GetVitessSession().GetQueryTimeout(), "the caller's request is left alone")
+}
+
+func TestTimeoutsExceeded(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	ctx := context.Background()
+
+	timeouts := Timeouts{Execute: 50 * time.Millisecond, StreamIdle: 50 * time.Millisecond}
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), append(opts, WithTimeouts(timeouts))...)
+	require.NoError(t, err)
+
+	_, err = conn.Execute(ctx, "sleep", nil)
+	assert.Equal(t, connect.CodeDeadlineExceeded, connect.CodeOf(err))
+
+	stream, err := conn.StreamExecute(ctx, "stall", nil)
+	require.NoError(t, err)
+	n := 0
+	for stream.Receive() {
+		n++
+	}
+	assert.Equal(t, 1, n)
+	assert.ErrorIs(t, stream.Err(), ErrStreamIdle)
+	assert.Equal(t, connect.CodeDeadlineExceeded, connect.CodeOf(stream.Err()))
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"connectrpc.com/connect"
+)
+
+// Tracer starts a span for each RPC. It is deliberately small, so that
+// OpenTelemetry or any other tracing library can be adapted to it.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type Span interface {
+	// SpanContext identifies the span, and is sent to the server
+	// in a W3C traceparent header when valid.
+	SpanContext() SpanContext
+	SetAttributes(attrs ...Attribute)
+	SetError(err error)
+	End()
+}
+
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanContext is the part of a span propagated to the server.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// Attribute keys set on spans.
+const (
+	AttrRPCSystem    = "rpc.system"
+	AttrRPCService   = "rpc.service"
+	AttrRPCMethod    = "rpc.method"
+	AttrStatusCode   = "rpc.connect_rpc.error_code"
+	AttrStatement    = "db.statement"
+	AttrRows         = "db.psdb.rows"
+	AttrRowsAffected = "db.psdb.rows_affected"
+	AttrResponseSize = "db.psdb.response_size"
+	AttrServerTiming = "db.psdb.server_timing"
+	AttrVTRPCCode    = "db.psdb.vtrpc_code"
+)
+
+const traceparentHeader = "Traceparent"
+
+// WithTracer starts a span for every RPC made by the client. Retries are
+// covered by a single span when WithTracer comes before WithRetryPolicy,
+// and get a span each when it comes after.
+func WithTracer(tracer Tracer) Option {
+	return func(c *config) {
+		c.interceptors = append(c.interceptors, newTracingInterceptor(tracer))
+	}
+}
+
+type tracingInterceptor struct {
+	tracer Tracer
+}
+
+func newTracingInterceptor(tracer Tracer) *tracingInterceptor {
+	return &tracingInterceptor{tracer: tracer}
+}
+
+func (i *tracingInterceptor) start(ctx context.Context, spec connect.Spec) (context.Context, Span) {
+	name := strings.TrimPrefix(spec.Procedure, "/")
+	ctx, span := i.tracer.Start(ctx, name)
+	service, method, _ := strings.Cut(name, "/")
+	span.SetAttributes(
+		Attribute{AttrRPCService, service},
+		Attribute{AttrRPCMethod, method},
+	)
+	return ctx, span
+}
+
+// rpcSystem returns the rpc.system of protocol, as named
+// in the OpenTelemetry semantic conventions.
+func rpcSystem(protocol string) string {
+	switch protocol {
+	case connect.ProtocolGRPC:
+		return "grpc"
+	case connect.ProtocolGRPCWeb:
+		return "grpc_web"
+	}
+	return "connect_rpc"
+}
+
+func injectTraceparent(span Span, header http.Header) {
+	if sc := span.SpanContext(); sc.IsValid() {
+		header[traceparentHeader] = []string{sc.Traceparent()}
+	}
+}
+
+func (i *tracingInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		ctx, span := i.start(ctx, req.Spec())
+		span.SetAttributes(Attribute{AttrRPCSystem, rpcSystem(req.Peer().Protocol)})
+		defer span.End()
+		injectTraceparent(span, req.Header())
+		setRequestAttributes(span, req.Any())
+
+		res, err := next(ctx, req)
+		if err != nil {
+			setErrorAttributes(span, err)
+			return nil, err
+		}
+		msg := res.Any()
+		rows, affected := rowsOf(msg)
+		setResponseAttributes(span, msg, rows, affected, sizeOf(msg))
+		return res, nil
+	}
+}
+
+func (i *tracingInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		ctx, span := i.start(ctx, spec)
+		conn := next(ctx, spec)
+		span.SetAttributes(Attribute{AttrRPCSystem, rpcSystem(conn.Peer().Protocol)})
+		injectTraceparent(span, conn.RequestHeader())
+		return &tracingStreamConn{StreamingClientConn: conn, span: span}
+	}
+}
+
+func (*tracingInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// tracingStreamConn keeps a span open until the response stream ends,
+// adding up rows and sizes across messages.
+type tracingStreamConn struct {
+	connect.StreamingClientConn
+	span Span
+
+	once           sync.Once
+	rows, affected int64
+	size           int
+	last           any
+}
+
+func (c *tracingStreamConn) Send(msg any) error {
+	setRequestAttributes(c.span, msg)
+	err := c.StreamingClientConn.Send(msg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.end(err)
+	}
+	return err
+}
+
+func (c *tracingStreamConn) Receive(msg any) error {
+	err := c.StreamingClientConn.Receive(msg)
+	if errors.Is(err, io.EOF) {
+		c.end(nil)
+		return err
+	}
+	if err != nil {
+		c.end(err)
+		return err
+	}
+	rows, affected := rowsOf(msg)
+	c.rows += rows
+	c.affected += affected
+	c.size += sizeOf(msg)
+	c.last = msg
+	return nil
+}
+
+func (c *tracingStreamConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	c.end(nil)
+	return err
+}
+
+func (c *tracingStreamConn) end(err error) {
+	c.once.Do(func() {
+		if err != nil {
+			setErrorAttributes(c.span, err)
+		} else {
+			setResponseAttributes(c.span, c.last, c.rows, c.affected, c.size)
+		}
+		c.span.End()
+	})
+}
+
+func setRequestAttributes(span Span, msg any) {
+	if query := queryOf(msg); query != "" {
+		span.SetAttributes(Attribute{AttrStatement, normalizeQuery(query)})
+	}
+}
+
+func setResponseAttributes(span Span, msg any, rows, affected int64, size int) {
+	span.SetAttributes(
+		Attribute{AttrRows, rows},
+		Attribute{AttrRowsAffected, affected},
+		Attribute{AttrResponseSize, size},
+	)
+	if timing, ok := timingOf(msg); ok {
+		span.SetAttributes(Attribute{AttrServerTiming, timing})
+	}
+	if rpcErr := rpcErrorOf(msg); rpcErr != nil {
+		span.SetAttributes(Attribute{AttrVTRPCCode, rpcErr.GetCode().String()})
+		span.SetError(errors.New(redactErrorMessage(rpcErr.GetMessage(), false, false)))
+	}
+}
+
+func setErrorAttributes(span Span, err error) {
+	span.SetAttributes(Attribute{AttrStatusCode, connect.CodeOf(err).String()})
+	span.SetError(&redactedError{err, redactErrorMessage(err.Error(), false, false)})
+}
+
+// redactedError is err with the values in its message hidden, as they
+// are in statement attributes.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+)
+
+// memoryTracer records every span in memory.
+type memoryTracer struct {
+	mu    sync.Mutex
+	spans []*memorySpan
+}
+
+type memorySpan struct {
+	name  string
+	sc    SpanContext
+	attrs map[string]any
+	err   error
+	ended bool
+}
+
+func (t *memoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &memorySpan{
+		name:  name,
+		attrs: make(map[string]any),
+		sc: SpanContext{
+			TraceID: [16]byte{0x0a, 15: byte(len(t.spans) + 1)},
+			SpanID:  [8]byte{0x0b, 7: byte(len(t.spans) + 1)},
+			Sampled: true,
+		},
+	}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func (s *memorySpan) SpanContext() SpanContext { return s.sc }
+func (s *memorySpan) SetError(err error)       { s.err = err }
+func (s *memorySpan) End()                     { s.ended = true }
+
+func (s *memorySpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func TestTracing(t *testing.T) {
+	db := &fakeDatabase{}
+	addr, opts := newTestServer(t, db)
+	tracer := &memoryTracer{}
+	ctx := context.Background()
+
+	conn, err := Dial(ctx, addr, auth.NewBasicAuth("user", "pass"), append(opts, WithTracer(tracer))...)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "select * from t where id = 42 and name = 'bob'", nil)
+	require.NoError(t, err)
+	_, err = conn.Execute(ctx, "duplicate", nil)
+	require.Error(t, err)
+	stream, err := conn.StreamExecute(ctx, "select 1", nil)
+	require.NoError(t, err)
+	for stream.Receive() {
+	}
+	require.NoError(t, stream.Err())
+
+	require.Len(t, tracer.spans, 4)
+	for i, span := range tracer.spans {
+		assert.True(t, span.ended)
+		assert.Equal(t, span.sc.Traceparent(), db.headers[i].Get("Traceparent"))
+	}
+
+	create := tracer.spans[0]
+	assert.Equal(t, "psdb.v1alpha1.Database/CreateSession", create.name)
+	assert.Equal(t, "psdb.v1alpha1.Database", create.attrs[AttrRPCService])
+	assert.Equal(t, "CreateSession", create.attrs[AttrRPCMethod])
+
+	execute := tracer.spans[1]
+	assert.Equal(t, "select * from t where id = ? and name = ?", execute.attrs[AttrStatement])
+	assert.Equal(t, int64(1), execute.attrs[AttrRowsAffected])
+	assert.Equal(t, 0.001, execute.attrs[AttrServerTiming])
+	assert.Positive(t, execute.attrs[AttrResponseSize])
+	assert.NoError(t, execute.err)
+
+	duplicate := tracer.spans[2]
+	assert.Equal(t, "ALREADY_EXISTS", duplicate.attrs[AttrVTRPCCode])
+	require.Error(t, duplicate.err)
+	assert.Contains(t, duplicate.err.Error(), "(errno 1062)")
+	assert.NotContains(t, duplicate.err.Error(), "alice")
+
+	streaming := tracer.spans[3]
+	assert.Equal(t, "psdb.v1alpha1.Database/StreamExecute", streaming.name)
+	assert.Equal(t, int64(6), streaming.attrs[AttrRows])
+	assert.NotContains(t, streaming.attrs, AttrServerTiming)
+}
+
+func TestSpanContextTraceparent(t *testing.T) {
+	sc := SpanContext{
+		TraceID: [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		Sampled: true,
+	}
+	assert.True(t, sc.IsValid())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+	assert.False(t, SpanContext{}.IsValid())
+}
@@ -0,0 +1,165 @@
+// Package errors converts the vitess RPCError returned inside Database
+// responses into a Go error, and classifies it.
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	vtrpcpb "github.com/planetscale/vitess-types/gen/vitess/vtrpc/v22"
+)
+
+// MySQL error numbers used for classification.
+const (
+	ErrnoTooManyConnections  = 1040
+	ErrnoServerShutdown      = 1053
+	ErrnoDupEntry            = 1062
+	ErrnoNetReadInterrupted  = 1159
+	ErrnoNetWriteInterrupted = 1161
+	ErrnoLockWaitTimeout     = 1205
+	ErrnoDeadlock            = 1213
+	ErrnoOptionPreventsStmt  = 1290
+	ErrnoDupEntryWithKeyName = 1586
+	ErrnoReadOnlyTransaction = 1792
+	ErrnoReadOnlyMode        = 1836
+	ErrnoInnodbReadOnly      = 1874
+	ErrnoConnHostError       = 2002
+	ErrnoConnectionRefused   = 2003
+	ErrnoServerGone          = 2006
+	ErrnoServerLost          = 2013
+)
+
+// Error is an RPCError returned by the server.
+type Error struct {
+	Code    vtrpcpb.Code
+	Message string
+	// Errno and SQLState are parsed from Message, and are
+	// zero when the error didn't come from MySQL.
+	Errno    int
+	SQLState string
+}
+
+var errnoRe = regexp.MustCompile(`\(errno (\d+)\) \(sqlstate (\w+)\)`)
+
+// New converts an RPCError, returning nil if e is nil.
+func New(e *vtrpcpb.RPCError) error {
+	if e == nil {
+		return nil
+	}
+	err := &Error{
+		Code:    e.GetCode(),
+		Message: e.GetMessage(),
+	}
+	// vitess may wrap an error more than once, the innermost
+	// MySQL error comes last
+	if m := errnoRe.FindAllStringSubmatch(err.Message, -1); len(m) > 0 {
+		last := m[len(m)-1]
+		err.Errno, _ = strconv.Atoi(last[1])
+		err.SQLState = last[2]
+	}
+	return err
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Is matches another *Error with the same Code, and the same Errno if
+// target has one. This lets a bare &Error{Code: ...} be used as a target.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return t.Code == e.Code && (t.Errno == 0 || t.Errno == e.Errno)
+}
+
+func as(err error) (*Error, bool) {
+	var e *Error
+	ok := stderrors.As(err, &e)
+	return e, ok
+}
+
+// Code returns the vtrpc Code of err, or Code_OK if err is not an *Error.
+func Code(err error) vtrpcpb.Code {
+	if e, ok := as(err); ok {
+		return e.Code
+	}
+	return vtrpcpb.Code_OK
+}
+
+// Errno returns the MySQL error number of err, or 0 if there is none.
+func Errno(err error) int {
+	if e, ok := as(err); ok {
+		return e.Errno
+	}
+	return 0
+}
+
+// SQLState returns the SQLSTATE of err, or "" if there is none.
+func SQLState(err error) string {
+	if e, ok := as(err); ok {
+		return e.SQLState
+	}
+	return ""
+}
+
+func hasErrno(err error, errnos ...int) bool {
+	e, ok := as(err)
+	if !ok {
+		return false
+	}
+	for _, n := range errnos {
+		if e.Errno == n {
+			return true
+		}
+	}
+	return false
+}
+
+func IsDuplicateKey(err error) bool {
+	return hasErrno(err, ErrnoDupEntry, ErrnoDupEntryWithKeyName)
+}
+
+func IsDeadlock(err error) bool {
+	return hasErrno(err, ErrnoDeadlock)
+}
+
+func IsLockWaitTimeout(err error) bool {
+	return hasErrno(err, ErrnoLockWaitTimeout)
+}
+
+// IsReadOnly reports whether a write was rejected because the target,
+// or the transaction, is read only.
+func IsReadOnly(err error) bool {
+	return Code(err) == vtrpcpb.Code_READ_ONLY ||
+		hasErrno(err, ErrnoOptionPreventsStmt, ErrnoReadOnlyTransaction, ErrnoReadOnlyMode, ErrnoInnodbReadOnly)
+}
+
+// IsRetryable reports whether the statement may succeed if it is tried
+// again. For deadlocks and lock wait timeouts inside a transaction, it is
+// the whole transaction that has to be retried.
+func IsRetryable(err error) bool {
+	if IsDeadlock(err) || IsLockWaitTimeout(err) {
+		return true
+	}
+	if hasErrno(err,
+		ErrnoServerShutdown,
+		ErrnoTooManyConnections,
+		ErrnoNetReadInterrupted,
+		ErrnoNetWriteInterrupted,
+		ErrnoServerLost,
+		ErrnoServerGone,
+		ErrnoConnectionRefused,
+		ErrnoConnHostError,
+	) {
+		return true
+	}
+	switch Code(err) {
+	case vtrpcpb.Code_UNAVAILABLE, vtrpcpb.Code_CLUSTER_EVENT:
+		return true
+	}
+	return false
+}
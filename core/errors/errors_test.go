@@ -0,0 +1,64 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"testing"
+
+	vtrpcpb "github.com/planetscale/vitess-types/gen/vitess/vtrpc/v22"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	assert.Nil(t, New(nil))
+
+	err := New(&vtrpcpb.RPCError{
+		Code:    vtrpcpb.Code_ALREADY_EXISTS,
+		Message: "target: ks.-.primary: vttablet: Duplicate entry '1' for key 't.PRIMARY' (errno 1062) (sqlstate 23000) (CallerID: x)",
+	})
+	var e *Error
+	assert.True(t, stderrors.As(fmt.Errorf("wrapped: %w", err), &e))
+	assert.Equal(t, vtrpcpb.Code_ALREADY_EXISTS, e.Code)
+	assert.Equal(t, 1062, e.Errno)
+	assert.Equal(t, "23000", e.SQLState)
+	assert.Equal(t, 1062, Errno(err))
+	assert.Equal(t, "23000", SQLState(err))
+	assert.Equal(t, vtrpcpb.Code_ALREADY_EXISTS, Code(err))
+
+	assert.ErrorIs(t, err, &Error{Code: vtrpcpb.Code_ALREADY_EXISTS})
+	assert.ErrorIs(t, err, &Error{Code: vtrpcpb.Code_ALREADY_EXISTS, Errno: ErrnoDupEntry})
+	assert.NotErrorIs(t, err, &Error{Code: vtrpcpb.Code_ALREADY_EXISTS, Errno: ErrnoDeadlock})
+	assert.NotErrorIs(t, err, &Error{Code: vtrpcpb.Code_UNAVAILABLE})
+
+	err = New(&vtrpcpb.RPCError{Code: vtrpcpb.Code_INVALID_ARGUMENT, Message: "syntax error"})
+	assert.Equal(t, 0, Errno(err))
+	assert.Equal(t, "", SQLState(err))
+	assert.Equal(t, "INVALID_ARGUMENT: syntax error", err.Error())
+}
+
+func TestClassify(t *testing.T) {
+	mysql := func(code vtrpcpb.Code, errno int) error {
+		return New(&vtrpcpb.RPCError{Code: code, Message: fmt.Sprintf("boom (errno %d) (sqlstate HY000)", errno)})
+	}
+	cases := []struct {
+		err                                                      error
+		duplicateKey, deadlock, lockWaitTimeout, readOnly, retry bool
+	}{
+		{mysql(vtrpcpb.Code_ALREADY_EXISTS, ErrnoDupEntry), true, false, false, false, false},
+		{mysql(vtrpcpb.Code_ABORTED, ErrnoDeadlock), false, true, false, false, true},
+		{mysql(vtrpcpb.Code_DEADLINE_EXCEEDED, ErrnoLockWaitTimeout), false, false, true, false, true},
+		{mysql(vtrpcpb.Code_FAILED_PRECONDITION, ErrnoOptionPreventsStmt), false, false, false, true, false},
+		{New(&vtrpcpb.RPCError{Code: vtrpcpb.Code_READ_ONLY}), false, false, false, true, false},
+		{New(&vtrpcpb.RPCError{Code: vtrpcpb.Code_UNAVAILABLE}), false, false, false, false, true},
+		{New(&vtrpcpb.RPCError{Code: vtrpcpb.Code_CLUSTER_EVENT}), false, false, false, false, true},
+		{stderrors.New("plain"), false, false, false, false, false},
+		{nil, false, false, false, false, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.duplicateKey, IsDuplicateKey(c.err), "%v", c.err)
+		assert.Equal(t, c.deadlock, IsDeadlock(c.err), "%v", c.err)
+		assert.Equal(t, c.lockWaitTimeout, IsLockWaitTimeout(c.err), "%v", c.err)
+		assert.Equal(t, c.readOnly, IsReadOnly(c.err), "%v", c.err)
+		assert.Equal(t, c.retry, IsRetryable(c.err), "%v", c.err)
+	}
+}
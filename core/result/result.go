@@ -0,0 +1,154 @@
+// Package result decodes the rows of a vitess QueryResult into Go values.
+package result
+
+import (
+	"errors"
+
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+)
+
+var ErrMalformedRow = errors.New("malformed row")
+
+// Rows iterates the rows of a single QueryResult.
+type Rows struct {
+	fields []*querypb.Field
+	rows   []*querypb.Row
+	pos    int
+	cur    Row
+	err    error
+}
+
+// New returns an iterator over the rows of qr, such as the Result
+// of an ExecuteResponse.
+func New(qr *querypb.QueryResult) *Rows {
+	return newRows(qr.GetFields(), qr.GetRows())
+}
+
+func newRows(fields []*querypb.Field, rows []*querypb.Row) *Rows {
+	return &Rows{fields: fields, rows: rows}
+}
+
+func (r *Rows) Fields() []*querypb.Field {
+	return r.fields
+}
+
+// Columns returns the name of every field.
+func (r *Rows) Columns() []string {
+	names := make([]string, len(r.fields))
+	for i, f := range r.fields {
+		names[i] = f.GetName()
+	}
+	return names
+}
+
+// Next advances to the next row. It returns false when there are no more
+// rows, or when a row could not be split into its values.
+func (r *Rows) Next() bool {
+	if r.err != nil || r.pos >= len(r.rows) {
+		return false
+	}
+	r.cur, r.err = newRow(r.fields, r.rows[r.pos])
+	r.pos++
+	return r.err == nil
+}
+
+// Row returns the current row.
+func (r *Rows) Row() Row {
+	return r.cur
+}
+
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Scan decodes the current row into dest, see Row.Scan.
+func (r *Rows) Scan(dest ...any) error {
+	return r.cur.Scan(dest...)
+}
+
+// ScanStruct decodes the current row into a struct, see Row.ScanStruct.
+func (r *Rows) ScanStruct(dest any) error {
+	return r.cur.ScanStruct(dest)
+}
+
+// Stream decodes the messages of a StreamExecute, where only the first
+// message carries Fields and later messages carry only Rows.
+type Stream struct {
+	fields []*querypb.Field
+}
+
+// Rows returns an iterator over the rows of the next streamed QueryResult.
+func (s *Stream) Rows(qr *querypb.QueryResult) *Rows {
+	if fields := qr.GetFields(); len(fields) > 0 {
+		s.fields = fields
+	}
+	return newRows(s.fields, qr.GetRows())
+}
+
+// Fields returns the Fields received so far.
+func (s *Stream) Fields() []*querypb.Field {
+	return s.fields
+}
+
+// Row is a single row, with every value still in its MySQL text encoding.
+type Row struct {
+	fields []*querypb.Field
+	values [][]byte
+}
+
+func newRow(fields []*querypb.Field, row *querypb.Row) (Row, error) {
+	values := make([][]byte, len(row.GetLengths()))
+	var offset int64
+	for i, l := range row.GetLengths() {
+		// a negative length is a NULL
+		if l < 0 {
+			continue
+		}
+		if offset+l > int64(len(row.GetValues())) {
+			return Row{}, ErrMalformedRow
+		}
+		if l == 0 {
+			// Values is nil in a row of empty strings, which must
+			// still not read as NULL
+			values[i] = []byte{}
+			continue
+		}
+		values[i] = row.Values[offset : offset+l : offset+l]
+		offset += l
+	}
+	if len(values) != len(fields) {
+		return Row{}, ErrMalformedRow
+	}
+	return Row{fields: fields, values: values}, nil
+}
+
+func (r Row) Len() int {
+	return len(r.values)
+}
+
+// Raw returns the undecoded value of column i, or nil for NULL.
+func (r Row) Raw(i int) []byte {
+	return r.values[i]
+}
+
+func (r Row) IsNull(i int) bool {
+	return r.values[i] == nil
+}
+
+// Value decodes column i according to its field's type, see Decode.
+func (r Row) Value(i int) (any, error) {
+	return Decode(r.fields[i].GetType(), r.values[i])
+}
+
+// Values decodes every column of the row.
+func (r Row) Values() ([]any, error) {
+	out := make([]any, len(r.values))
+	for i := range r.values {
+		v, err := r.Value(i)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
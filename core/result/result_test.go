@@ -0,0 +1,212 @@
+package result
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	cases := []struct {
+		typ   querypb.Type
+		value []byte
+		out   any
+	}{
+		{querypb.Type_INT8, []byte("-1"), int64(-1)},
+		{querypb.Type_INT64, []byte("9223372036854775807"), int64(9223372036854775807)},
+		{querypb.Type_UINT64, []byte("18446744073709551615"), uint64(18446744073709551615)},
+		{querypb.Type_YEAR, []byte("2024"), uint64(2024)},
+		{querypb.Type_FLOAT64, []byte("1.5"), float64(1.5)},
+		{querypb.Type_DECIMAL, []byte("10.000000000000000001"), "10.000000000000000001"},
+		{querypb.Type_DATETIME, []byte("2024-02-03 04:05:06.123"), time.Date(2024, 2, 3, 4, 5, 6, 123000000, time.UTC)},
+		{querypb.Type_TIMESTAMP, []byte("2024-02-03 04:05:06"), time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)},
+		{querypb.Type_DATE, []byte("2024-02-03"), time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{querypb.Type_DATETIME, []byte("0000-00-00 00:00:00"), time.Time{}},
+		{querypb.Type_TIME, []byte("-838:59:59.5"), -(838*time.Hour + 59*time.Minute + 59*time.Second + 500*time.Millisecond)},
+		{querypb.Type_JSON, []byte(`{"a":1}`), json.RawMessage(`{"a":1}`)},
+		{querypb.Type_VARCHAR, []byte("foo"), "foo"},
+		{querypb.Type_ENUM, []byte("a"), "a"},
+		{querypb.Type_VARBINARY, []byte{0, 1}, []byte{0, 1}},
+		{querypb.Type_BIT, []byte{1}, []byte{1}},
+		{querypb.Type_INT64, nil, nil},
+	}
+	for _, c := range cases {
+		out, err := Decode(c.typ, c.value)
+		assert.Nil(t, err, c.typ.String())
+		assert.Equal(t, c.out, out, c.typ.String())
+	}
+
+	_, err := Decode(querypb.Type_INT64, []byte("x"))
+	assert.Error(t, err)
+	_, err = Decode(querypb.Type_DATE, []byte("yesterday"))
+	assert.Error(t, err)
+}
+
+var testFields = []*querypb.Field{
+	{Name: "id", Type: querypb.Type_UINT64},
+	{Name: "name", Type: querypb.Type_VARCHAR},
+	{Name: "created_at", Type: querypb.Type_DATETIME},
+	{Name: "price", Type: querypb.Type_DECIMAL},
+}
+
+func testRow(id, name, createdAt, price string, nulls ...int) *querypb.Row {
+	values := []string{id, name, createdAt, price}
+	row := &querypb.Row{}
+	for i, v := range values {
+		l := int64(len(v))
+		for _, n := range nulls {
+			if n == i {
+				l = -1
+			}
+		}
+		row.Lengths = append(row.Lengths, l)
+		if l > 0 {
+			row.Values = append(row.Values, v...)
+		}
+	}
+	return row
+}
+
+func TestRowsScanStruct(t *testing.T) {
+	type product struct {
+		ID        int64
+		Name      sql.NullString
+		CreatedAt *time.Time `psdb:"created_at"`
+		Price     float64
+		Ignored   string `psdb:"-"`
+	}
+
+	rows := New(&querypb.QueryResult{
+		Fields: testFields,
+		Rows: []*querypb.Row{
+			testRow("1", "foo", "2024-01-01 00:00:00", "1.25"),
+			testRow("2", "", "", "2.50", 1, 2),
+		},
+	})
+	var got []product
+	for rows.Next() {
+		var p product
+		require.NoError(t, rows.ScanStruct(&p))
+		got = append(got, p)
+	}
+	require.NoError(t, rows.Err())
+
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []product{
+		{ID: 1, Name: sql.NullString{String: "foo", Valid: true}, CreatedAt: &createdAt, Price: 1.25},
+		{ID: 2, Price: 2.5},
+	}, got)
+}
+
+type Base struct {
+	ID int64
+}
+
+type base struct {
+	ID int64
+}
+
+func TestRowScanStructEmbeddedPointer(t *testing.T) {
+	rows := New(&querypb.QueryResult{
+		Fields: testFields[:2],
+		Rows:   []*querypb.Row{{Lengths: []int64{1, 3}, Values: []byte("1foo")}},
+	})
+	require.True(t, rows.Next())
+
+	var p struct {
+		*Base
+		Name string
+	}
+	require.NoError(t, rows.ScanStruct(&p))
+	require.NotNil(t, p.Base)
+	assert.Equal(t, int64(1), p.ID)
+	assert.Equal(t, "foo", p.Name)
+
+	var unexported struct {
+		*base
+		Name string
+	}
+	assert.Error(t, rows.ScanStruct(&unexported))
+}
+
+func TestRowScan(t *testing.T) {
+	rows := New(&querypb.QueryResult{
+		Fields: testFields,
+		Rows:   []*querypb.Row{testRow("1", "", "2024-01-01 00:00:00", "1.25", 1)},
+	})
+	require.True(t, rows.Next())
+
+	var (
+		id        uint8
+		name      string
+		createdAt time.Time
+		price     string
+	)
+	assert.ErrorIs(t, rows.Scan(&id, &name, &createdAt, &price), ErrNull)
+	assert.ErrorIs(t, rows.Scan(&id), ErrColumnSize)
+
+	var namePtr *string
+	require.NoError(t, rows.Scan(&id, &namePtr, &createdAt, &price))
+	assert.Equal(t, uint8(1), id)
+	assert.Nil(t, namePtr)
+	assert.Equal(t, "1.25", price)
+
+	var small int8
+	rows = New(&querypb.QueryResult{
+		Fields: testFields[:1],
+		Rows:   []*querypb.Row{{Lengths: []int64{3}, Values: []byte("300")}},
+	})
+	require.True(t, rows.Next())
+	assert.Error(t, rows.Scan(&small))
+}
+
+func TestRowsMalformed(t *testing.T) {
+	rows := New(&querypb.QueryResult{
+		Fields: testFields[:1],
+		Rows:   []*querypb.Row{{Lengths: []int64{10}, Values: []byte("1")}},
+	})
+	assert.False(t, rows.Next())
+	assert.ErrorIs(t, rows.Err(), ErrMalformedRow)
+}
+
+func TestRowEmptyString(t *testing.T) {
+	// an empty string, as unmarshalled, with no Values at all
+	rows := New(&querypb.QueryResult{
+		Fields: testFields[1:2],
+		Rows:   []*querypb.Row{{Lengths: []int64{0}}},
+	})
+	require.True(t, rows.Next())
+	row := rows.Row()
+	assert.False(t, row.IsNull(0))
+	v, err := row.Value(0)
+	require.NoError(t, err)
+	assert.Equal(t, "", v)
+	var s sql.NullString
+	require.NoError(t, row.Scan(&s))
+	assert.Equal(t, sql.NullString{Valid: true}, s)
+}
+
+func TestStream(t *testing.T) {
+	var s Stream
+	var ids []any
+	for _, qr := range []*querypb.QueryResult{
+		{Fields: testFields[:1]},
+		{Rows: []*querypb.Row{{Lengths: []int64{1}, Values: []byte("1")}}},
+		{Rows: []*querypb.Row{{Lengths: []int64{1}, Values: []byte("2")}, {Lengths: []int64{-1}}}},
+	} {
+		rows := s.Rows(qr)
+		for rows.Next() {
+			v, err := rows.Row().Value(0)
+			require.NoError(t, err)
+			ids = append(ids, v)
+		}
+		require.NoError(t, rows.Err())
+	}
+	assert.Equal(t, []any{uint64(1), uint64(2), nil}, ids)
+	assert.Equal(t, []string{"id"}, New(&querypb.QueryResult{Fields: s.Fields()}).Columns())
+}
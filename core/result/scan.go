@@ -0,0 +1,294 @@
+package result
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TagName is the struct tag used by ScanStruct to name a column.
+const TagName = "psdb"
+
+var (
+	ErrNull       = errors.New("cannot scan NULL into a non-nullable destination")
+	ErrColumnSize = errors.New("number of destinations does not match number of columns")
+)
+
+// Scan decodes the row into dest, one pointer per column. A destination
+// may be a pointer to any type Decode produces, a type it converts to, a
+// sql.Scanner such as sql.NullString, or a pointer to a pointer, which is
+// set to nil for NULL.
+func (r Row) Scan(dest ...any) error {
+	if len(dest) != len(r.values) {
+		return ErrColumnSize
+	}
+	for i, d := range dest {
+		if err := r.scanColumn(i, reflect.ValueOf(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanStruct decodes the row into the struct pointed to by dest. Columns
+// are matched to exported fields by their `psdb:"name"` tag, or by the field
+// name, ignoring case. Fields tagged `psdb:"-"` and columns with no
+// matching field are skipped.
+func (r Row) ScanStruct(dest any) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ScanStruct: want pointer to struct, got %T", dest)
+	}
+	v = v.Elem()
+	fields := structFields(v.Type())
+	for i, f := range r.fields {
+		index, ok := fields[strings.ToLower(f.GetName())]
+		if !ok {
+			continue
+		}
+		field, err := fieldByIndex(v, index)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", f.GetName(), err)
+		}
+		if err := r.scanColumn(i, field.Addr()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is v.FieldByIndex, allocating nil pointers to embedded
+// structs on the way, as encoding/json does.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+func (r Row) scanColumn(i int, dest reflect.Value) error {
+	if dest.Kind() != reflect.Pointer || dest.IsNil() {
+		return fmt.Errorf("column %s: destination must be a non-nil pointer, got %s", r.fields[i].GetName(), dest.Type())
+	}
+	v, err := r.Value(i)
+	if err != nil {
+		return fmt.Errorf("column %s: %w", r.fields[i].GetName(), err)
+	}
+	if err := assign(dest.Elem(), v); err != nil {
+		return fmt.Errorf("column %s: %w", r.fields[i].GetName(), err)
+	}
+	return nil
+}
+
+var structFieldsCache sync.Map // map[reflect.Type]map[string][]int
+
+// structFields maps lowercased column names to field indexes.
+func structFields(t reflect.Type) map[string][]int {
+	if cached, ok := structFieldsCache.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup(TagName); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag, _, _ = strings.Cut(tag, ","); tag != "" {
+				name = tag
+			}
+		}
+		fields[strings.ToLower(name)] = f.Index
+	}
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+var (
+	scannerType  = reflect.TypeFor[sql.Scanner]()
+	timeType     = reflect.TypeFor[time.Time]()
+	durationType = reflect.TypeFor[time.Duration]()
+)
+
+// assign stores a decoded value v into dest.
+func assign(dest reflect.Value, v any) error {
+	if dest.Addr().Type().Implements(scannerType) {
+		return dest.Addr().Interface().(sql.Scanner).Scan(scannerValue(v))
+	}
+
+	if dest.Kind() == reflect.Pointer {
+		if v == nil {
+			dest.SetZero()
+			return nil
+		}
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		return assign(dest.Elem(), v)
+	}
+
+	if dest.Kind() == reflect.Interface && dest.NumMethod() == 0 {
+		if v == nil {
+			dest.SetZero()
+		} else {
+			dest.Set(reflect.ValueOf(v))
+		}
+		return nil
+	}
+
+	if v == nil {
+		return ErrNull
+	}
+
+	switch dest.Type() {
+	case timeType:
+		if t, ok := v.(time.Time); ok {
+			dest.Set(reflect.ValueOf(t))
+			return nil
+		}
+		return assignError(dest, v)
+	case durationType:
+		if d, ok := v.(time.Duration); ok {
+			dest.SetInt(int64(d))
+			return nil
+		}
+		return assignError(dest, v)
+	}
+
+	switch dest.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch v := v.(type) {
+		case int64:
+			n = v
+		case uint64:
+			if v > math.MaxInt64 {
+				return assignError(dest, v)
+			}
+			n = int64(v)
+		default:
+			return assignError(dest, v)
+		}
+		if dest.OverflowInt(n) {
+			return assignError(dest, v)
+		}
+		dest.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		switch v := v.(type) {
+		case uint64:
+			n = v
+		case int64:
+			if v < 0 {
+				return assignError(dest, v)
+			}
+			n = uint64(v)
+		default:
+			return assignError(dest, v)
+		}
+		if dest.OverflowUint(n) {
+			return assignError(dest, v)
+		}
+		dest.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch v := v.(type) {
+		case float64:
+			f = v
+		case int64:
+			f = float64(v)
+		case uint64:
+			f = float64(v)
+		case string:
+			// DECIMAL
+			var err error
+			if f, err = strconv.ParseFloat(v, 64); err != nil {
+				return assignError(dest, v)
+			}
+		default:
+			return assignError(dest, v)
+		}
+		dest.SetFloat(f)
+	case reflect.Bool:
+		switch v := v.(type) {
+		case int64:
+			dest.SetBool(v != 0)
+		case uint64:
+			dest.SetBool(v != 0)
+		default:
+			return assignError(dest, v)
+		}
+	case reflect.String:
+		dest.SetString(textValue(v))
+	case reflect.Slice:
+		if dest.Type().Elem().Kind() != reflect.Uint8 {
+			return assignError(dest, v)
+		}
+		// copy, so the destination doesn't pin the whole response
+		b := []byte(textValue(v))
+		dest.SetBytes(b)
+	default:
+		return assignError(dest, v)
+	}
+	return nil
+}
+
+// textValue formats v back into text, the same way MySQL would.
+func textValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case json.RawMessage:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.Format(datetimeLayout)
+	}
+	return fmt.Sprint(v)
+}
+
+// scannerValue converts v into one of the types a sql.Scanner expects.
+func scannerValue(v any) any {
+	switch v := v.(type) {
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return strconv.FormatUint(v, 10)
+	case json.RawMessage:
+		return []byte(v)
+	case time.Duration:
+		return int64(v)
+	}
+	return v
+}
+
+func assignError(dest reflect.Value, v any) error {
+	return fmt.Errorf("cannot assign %T to %s", v, dest.Type())
+}
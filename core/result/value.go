@@ -0,0 +1,156 @@
+package result
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+)
+
+const (
+	dateLayout     = "2006-01-02"
+	datetimeLayout = "2006-01-02 15:04:05.999999"
+)
+
+// Decode converts a value in its MySQL text encoding into a Go value.
+// A nil value is a NULL, and decodes to nil.
+//
+//	signed integers                  int64
+//	unsigned integers, YEAR          uint64
+//	FLOAT, DOUBLE                    float64
+//	DECIMAL                          string, to keep its precision
+//	DATETIME, TIMESTAMP, DATE        time.Time, in UTC
+//	TIME                             time.Duration
+//	JSON                             json.RawMessage
+//	CHAR, VARCHAR, TEXT, ENUM, SET   string
+//	everything else                  []byte
+func Decode(typ querypb.Type, value []byte) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch {
+	case isIntegral(typ) && isUnsigned(typ):
+		return parseUint(typ, value)
+	case isIntegral(typ):
+		return parseInt(typ, value)
+	case isFloat(typ):
+		return parseFloat(typ, value)
+	}
+
+	switch typ {
+	case querypb.Type_NULL_TYPE:
+		return nil, nil
+	case querypb.Type_DECIMAL:
+		return string(value), nil
+	case querypb.Type_DATETIME, querypb.Type_TIMESTAMP:
+		return parseTime(typ, datetimeLayout, value)
+	case querypb.Type_DATE:
+		return parseTime(typ, dateLayout, value)
+	case querypb.Type_TIME:
+		return parseDuration(value)
+	case querypb.Type_JSON:
+		return json.RawMessage(value), nil
+	case querypb.Type_CHAR, querypb.Type_VARCHAR, querypb.Type_TEXT,
+		querypb.Type_ENUM, querypb.Type_SET:
+		return string(value), nil
+	}
+	return value, nil
+}
+
+func isIntegral(typ querypb.Type) bool {
+	return int32(typ)&int32(querypb.Flag_ISINTEGRAL) != 0
+}
+
+func isUnsigned(typ querypb.Type) bool {
+	return int32(typ)&int32(querypb.Flag_ISUNSIGNED) != 0
+}
+
+func isFloat(typ querypb.Type) bool {
+	return int32(typ)&int32(querypb.Flag_ISFLOAT) != 0
+}
+
+func parseInt(typ querypb.Type, value []byte) (int64, error) {
+	v, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, decodeError(typ, value, err)
+	}
+	return v, nil
+}
+
+func parseUint(typ querypb.Type, value []byte) (uint64, error) {
+	v, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return 0, decodeError(typ, value, err)
+	}
+	return v, nil
+}
+
+func parseFloat(typ querypb.Type, value []byte) (float64, error) {
+	v, err := strconv.ParseFloat(string(value), 64)
+	if err != nil {
+		return 0, decodeError(typ, value, err)
+	}
+	return v, nil
+}
+
+func parseTime(typ querypb.Type, layout string, value []byte) (time.Time, error) {
+	s := string(value)
+	// MySQL's zero dates can't be represented by time.Time
+	if strings.HasPrefix(s, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(layout, s, time.UTC)
+	if err != nil {
+		return time.Time{}, decodeError(typ, value, err)
+	}
+	return t, nil
+}
+
+// parseDuration parses a TIME, formatted as [-]HHH:MM:SS[.ffffff].
+func parseDuration(value []byte) (time.Duration, error) {
+	s := string(value)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	var frac time.Duration
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		digits := s[dot+1:]
+		if len(digits) > 9 {
+			return 0, decodeError(querypb.Type_TIME, value, nil)
+		}
+		n, err := strconv.ParseUint(digits+strings.Repeat("0", 9-len(digits)), 10, 64)
+		if err != nil {
+			return 0, decodeError(querypb.Type_TIME, value, err)
+		}
+		frac = time.Duration(n)
+		s = s[:dot]
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, decodeError(querypb.Type_TIME, value, nil)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, err := strconv.ParseUint(parts[i], 10, 32)
+		if err != nil {
+			return 0, decodeError(querypb.Type_TIME, value, err)
+		}
+		d += time.Duration(n) * unit
+	}
+	d += frac
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+func decodeError(typ querypb.Type, value []byte, err error) error {
+	if err == nil {
+		return fmt.Errorf("cannot decode %q as %s", value, typ)
+	}
+	return fmt.Errorf("cannot decode %q as %s: %w", value, typ, err)
+}
@@ -4,6 +4,7 @@ go 1.24.5
 
 require (
 	connectrpc.com/connect v1.18.1
+	github.com/klauspost/compress v1.16.7
 	github.com/klauspost/connect-compress/v2 v2.0.0
 	github.com/planetscale/vitess-types v0.0.0-20260313221731-c96dbf730f7d
 	github.com/planetscale/vtprotobuf v0.6.1-0.20241121165744-79df5c4772f2
@@ -14,7 +15,6 @@ require (
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/klauspost/compress v1.16.7 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/sys v0.11.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
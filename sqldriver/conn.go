@@ -0,0 +1,165 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+
+	"github.com/planetscale/psdb/core/bindvars"
+	"github.com/planetscale/psdb/core/client"
+)
+
+var errTxInProgress = errors.New("a transaction is already in progress")
+
+type conn struct {
+	conn *client.Conn
+}
+
+var (
+	_ driver.Conn               = (*conn)(nil)
+	_ driver.ConnPrepareContext = (*conn)(nil)
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.Pinger             = (*conn)(nil)
+	_ driver.NamedValueChecker  = (*conn)(nil)
+)
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	res, err := c.conn.Prepare(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{conn: c, query: query, numInput: int(res.GetParamsCount())}, nil
+}
+
+func (c *conn) Close() error {
+	return c.conn.Close(context.Background())
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.conn.InTransaction() {
+		return nil, errTxInProgress
+	}
+
+	if level := sql.IsolationLevel(opts.Isolation); level != sql.LevelDefault {
+		isolation, err := isolationLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.exec(ctx, "set transaction isolation level "+isolation, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	begin := "start transaction"
+	if opts.ReadOnly {
+		begin += " read only"
+	}
+	if _, err := c.exec(ctx, begin, nil); err != nil {
+		return nil, err
+	}
+	return &tx{conn: c}, nil
+}
+
+// CheckNamedValue converts arguments into BindVariables up front, so that
+// database/sql passes through types its default converter rejects, such
+// as large uint64 values and slices for IN (...).
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	bv, err := bindvars.Value(nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value = bv
+	return nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	_, err := c.exec(ctx, "select 1", nil)
+	return err
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	bindVars, err := bindVariables(args)
+	if err != nil {
+		return nil, err
+	}
+	return c.exec(ctx, query, bindVars)
+}
+
+func (c *conn) exec(ctx context.Context, query string, bindVars map[string]*querypb.BindVariable) (driver.Result, error) {
+	res, err := c.conn.Execute(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	return &execResult{
+		lastInsertID: int64(res.GetResult().GetInsertId()),
+		rowsAffected: int64(res.GetResult().GetRowsAffected()),
+	}, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	bindVars, err := bindVariables(args)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := c.conn.StreamExecute(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	return newRows(stream)
+}
+
+type execResult struct {
+	lastInsertID, rowsAffected int64
+}
+
+func (r *execResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r *execResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+func isolationLevel(level sql.IsolationLevel) (string, error) {
+	switch level {
+	case sql.LevelReadUncommitted:
+		return "read uncommitted", nil
+	case sql.LevelReadCommitted:
+		return "read committed", nil
+	case sql.LevelRepeatableRead:
+		return "repeatable read", nil
+	case sql.LevelSerializable:
+		return "serializable", nil
+	}
+	return "", fmt.Errorf("unsupported isolation level: %s", level)
+}
+
+// bindVariables names positional arguments v1, v2, ..., which is what
+// vitess names each ? placeholder when parsing a query.
+func bindVariables(args []driver.NamedValue) (map[string]*querypb.BindVariable, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	bindVars := make(map[string]*querypb.BindVariable, len(args))
+	for _, arg := range args {
+		name := arg.Name
+		if name == "" {
+			name = bindvars.Name(arg.Ordinal)
+		}
+		bv, err := bindvars.Value(arg.Value)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %w", name, err)
+		}
+		bindVars[name] = bv
+	}
+	return bindVars, nil
+}
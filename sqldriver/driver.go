@@ -0,0 +1,92 @@
+// Package sqldriver is a database/sql driver that talks to the PlanetScale
+// Database service over HTTP/2, instead of the MySQL protocol.
+//
+//	db, err := sql.Open("psdb", "user:password@aws.connect.psdb.cloud")
+//
+// The username and password in a DSN must be URL escaped.
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/url"
+
+	"github.com/planetscale/psdb/auth"
+	"github.com/planetscale/psdb/core/client"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+const DriverName = "psdb"
+
+var ErrInvalidDSN = errors.New("invalid DSN, want user:password@host[:port]")
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+type Driver struct{}
+
+var (
+	_ driver.Driver        = (*Driver)(nil)
+	_ driver.DriverContext = (*Driver)(nil)
+)
+
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	addr, auth, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewConnector(addr, auth), nil
+}
+
+// ParseDSN splits a user:password@host[:port] DSN into an address and
+// Basic credentials.
+func ParseDSN(dsn string) (string, *auth.Authorization, error) {
+	u, err := url.Parse("//" + dsn)
+	if err != nil {
+		return "", nil, ErrInvalidDSN
+	}
+	if u.Host == "" || u.User == nil || u.Path != "" {
+		return "", nil, ErrInvalidDSN
+	}
+	password, _ := u.User.Password()
+	return u.Host, auth.NewBasicAuth(u.User.Username(), password), nil
+}
+
+// Connector opens connections against a single address. Every connection
+// from a Connector shares the same underlying DatabaseClient, and with it
+// the same HTTP/2 transport.
+type Connector struct {
+	client psdbv1alpha1connect.DatabaseClient
+}
+
+var _ driver.Connector = (*Connector)(nil)
+
+// NewConnector returns a Connector for use with sql.OpenDB.
+func NewConnector(addr string, auth *auth.Authorization, opts ...client.Option) *Connector {
+	return &Connector{
+		client: client.New(addr, psdbv1alpha1connect.NewDatabaseClient, auth, opts...),
+	}
+}
+
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	cc, err := client.NewConn(ctx, c.client)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{conn: cc}, nil
+}
+
+func (c *Connector) Driver() driver.Driver {
+	return &Driver{}
+}
@@ -0,0 +1,221 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"connectrpc.com/connect"
+	compress "github.com/klauspost/connect-compress/v2"
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+	vtgatepb "github.com/planetscale/vitess-types/gen/vitess/vtgate/v22"
+	vtrpcpb "github.com/planetscale/vitess-types/gen/vitess/vtrpc/v22"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/planetscale/psdb/auth"
+	"github.com/planetscale/psdb/core/client"
+	psdbv1alpha1 "github.com/planetscale/psdb/types/psdb/v1alpha1"
+	"github.com/planetscale/psdb/types/psdb/v1alpha1/psdbv1alpha1connect"
+)
+
+func TestParseDSN(t *testing.T) {
+	cases := []struct {
+		dsn  string
+		addr string
+		auth *auth.Authorization
+		err  error
+	}{
+		{"user:pass@example.com", "example.com", auth.NewBasicAuth("user", "pass"), nil},
+		{"user:p%40ss@example.com:443", "example.com:443", auth.NewBasicAuth("user", "p@ss"), nil},
+		{"example.com", "", nil, ErrInvalidDSN},
+		{"user:pass@", "", nil, ErrInvalidDSN},
+		{"user:pass@example.com/db", "", nil, ErrInvalidDSN},
+	}
+	for _, c := range cases {
+		addr, auth, err := ParseDSN(c.dsn)
+		if c.err == nil {
+			assert.Nil(t, err)
+			assert.Equal(t, c.addr, addr)
+			assert.Equal(t, c.auth, auth)
+		} else {
+			assert.Equal(t, c.err, err)
+		}
+	}
+}
+
+type fakeDatabase struct {
+	psdbv1alpha1connect.UnimplementedDatabaseHandler
+
+	mu       sync.Mutex
+	queries  []string
+	bindVars []map[string]*querypb.BindVariable
+}
+
+func (d *fakeDatabase) CreateSession(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.CreateSessionRequest],
+) (*connect.Response[psdbv1alpha1.CreateSessionResponse], error) {
+	return connect.NewResponse(&psdbv1alpha1.CreateSessionResponse{
+		Session: &psdbv1alpha1.Session{VitessSession: &vtgatepb.Session{}},
+	}), nil
+}
+
+func (d *fakeDatabase) Execute(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.ExecuteRequest],
+) (*connect.Response[psdbv1alpha1.ExecuteResponse], error) {
+	d.mu.Lock()
+	d.queries = append(d.queries, req.Msg.Query)
+	d.bindVars = append(d.bindVars, req.Msg.BindVariables)
+	d.mu.Unlock()
+
+	session := req.Msg.Session
+	res := &psdbv1alpha1.ExecuteResponse{Session: session}
+	switch req.Msg.Query {
+	case "start transaction":
+		session.VitessSession.InTransaction = true
+	case "commit", "rollback":
+		session.VitessSession.InTransaction = false
+	case "insert into t values (?)":
+		res.Result = &querypb.QueryResult{RowsAffected: 1, InsertId: 42}
+	case "fail":
+		res.Error = &vtrpcpb.RPCError{Code: vtrpcpb.Code_INVALID_ARGUMENT, Message: "syntax error"}
+	}
+	return connect.NewResponse(res), nil
+}
+
+func (d *fakeDatabase) StreamExecute(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.ExecuteRequest],
+	stream *connect.ServerStream[psdbv1alpha1.ExecuteResponse],
+) error {
+	msgs := []*querypb.QueryResult{
+		{Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT64}, {Name: "name", Type: querypb.Type_VARCHAR}}},
+		{Rows: []*querypb.Row{{Lengths: []int64{1, 3}, Values: []byte("1foo")}}},
+		{Rows: []*querypb.Row{{Lengths: []int64{1, -1}, Values: []byte("2")}}},
+	}
+	for _, msg := range msgs {
+		if err := stream.Send(&psdbv1alpha1.ExecuteResponse{Session: req.Msg.Session, Result: msg}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *fakeDatabase) Prepare(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.PrepareRequest],
+) (*connect.Response[psdbv1alpha1.PrepareResponse], error) {
+	return connect.NewResponse(&psdbv1alpha1.PrepareResponse{
+		Session:     req.Msg.Session,
+		ParamsCount: 1,
+	}), nil
+}
+
+func (d *fakeDatabase) CloseSession(
+	ctx context.Context,
+	req *connect.Request[psdbv1alpha1.CloseSessionRequest],
+) (*connect.Response[psdbv1alpha1.CloseSessionResponse], error) {
+	return connect.NewResponse(&psdbv1alpha1.CloseSessionResponse{}), nil
+}
+
+func newTestDB(t *testing.T) (*sql.DB, *fakeDatabase) {
+	t.Helper()
+	db := &fakeDatabase{}
+	mux := http.NewServeMux()
+	mux.Handle(psdbv1alpha1connect.NewDatabaseHandler(db, compress.WithAll(compress.LevelFastest)))
+	srv := httptest.NewUnstartedServer(mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	sqlDB := sql.OpenDB(NewConnector(
+		srv.Listener.Addr().String(),
+		auth.NewBasicAuth("user", "pass"),
+		client.WithHTTPClient(srv.Client()),
+	))
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return sqlDB, db
+}
+
+func TestDriver(t *testing.T) {
+	sqlDB, db := newTestDB(t)
+	ctx := context.Background()
+
+	res, err := sqlDB.ExecContext(ctx, "insert into t values (?)", int64(7))
+	require.NoError(t, err)
+	id, _ := res.LastInsertId()
+	assert.Equal(t, int64(42), id)
+	assert.Equal(t, []byte("7"), db.bindVars[0]["v1"].Value)
+	assert.Equal(t, querypb.Type_INT64, db.bindVars[0]["v1"].Type)
+
+	rows, err := sqlDB.QueryContext(ctx, "select id, name from t")
+	require.NoError(t, err)
+	cols, _ := rows.Columns()
+	assert.Equal(t, []string{"id", "name"}, cols)
+	types, err := rows.ColumnTypes()
+	require.NoError(t, err)
+	assert.Equal(t, "BIGINT", types[0].DatabaseTypeName())
+	assert.Equal(t, "VARCHAR", types[1].DatabaseTypeName())
+
+	type row struct {
+		id   int
+		name sql.NullString
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		require.NoError(t, rows.Scan(&r.id, &r.name))
+		got = append(got, r)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []row{
+		{1, sql.NullString{String: "foo", Valid: true}},
+		{2, sql.NullString{}},
+	}, got)
+
+	_, err = sqlDB.ExecContext(ctx, "fail")
+	assert.EqualError(t, err, "INVALID_ARGUMENT: syntax error")
+
+	_, err = sqlDB.ExecContext(ctx, "insert into t values (?)", []uint64{1, 18446744073709551615})
+	require.NoError(t, err)
+	last := db.bindVars[len(db.bindVars)-1]["v1"]
+	assert.Equal(t, querypb.Type_TUPLE, last.Type)
+	assert.Equal(t, []byte("18446744073709551615"), last.Values[1].Value)
+}
+
+func TestDriverTx(t *testing.T) {
+	sqlDB, db := newTestDB(t)
+	ctx := context.Background()
+
+	tx, err := sqlDB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	require.NoError(t, err)
+	_, err = tx.ExecContext(ctx, "insert into t values (?)", "x")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	assert.Equal(t, []string{
+		"set transaction isolation level read committed",
+		"start transaction",
+		"insert into t values (?)",
+		"commit",
+	}, db.queries)
+}
+
+func TestDriverPrepare(t *testing.T) {
+	sqlDB, _ := newTestDB(t)
+
+	stmt, err := sqlDB.Prepare("insert into t values (?)")
+	require.NoError(t, err)
+	defer stmt.Close()
+
+	_, err = stmt.Exec()
+	assert.Error(t, err)
+	_, err = stmt.Exec(1)
+	assert.NoError(t, err)
+}
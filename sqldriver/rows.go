@@ -0,0 +1,142 @@
+package sqldriver
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	querypb "github.com/planetscale/vitess-types/gen/vitess/query/v22"
+
+	"github.com/planetscale/psdb/core/client"
+	"github.com/planetscale/psdb/core/result"
+)
+
+// rows reads a StreamExecute. Fields are only sent in the first message,
+// rows may follow in any number of later messages.
+type rows struct {
+	stream  *client.ExecuteStream
+	decoder result.Stream
+	cur     *result.Rows
+}
+
+var (
+	_ driver.Rows                           = (*rows)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+)
+
+func newRows(stream *client.ExecuteStream) (*rows, error) {
+	r := &rows{stream: stream}
+	r.cur = r.decoder.Rows(nil)
+	if err := r.receive(); err != nil && err != io.EOF {
+		stream.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// receive reads the next message from the stream.
+func (r *rows) receive() error {
+	if !r.stream.Receive() {
+		if err := r.stream.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	r.cur = r.decoder.Rows(r.stream.Msg().GetResult())
+	return nil
+}
+
+func (r *rows) Columns() []string {
+	return r.cur.Columns()
+}
+
+// ColumnTypeDatabaseTypeName returns the MySQL name of the column's type,
+// such as BIGINT UNSIGNED or VARCHAR.
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	t := r.decoder.Fields()[index].GetType()
+	if name, ok := mysqlTypeNames[t]; ok {
+		return name
+	}
+	return t.String()
+}
+
+// mysqlTypeNames maps vitess types to the names MySQL gives them.
+// Types without a MySQL counterpart keep their vitess name.
+var mysqlTypeNames = map[querypb.Type]string{
+	querypb.Type_NULL_TYPE: "NULL",
+	querypb.Type_INT8:      "TINYINT",
+	querypb.Type_UINT8:     "TINYINT UNSIGNED",
+	querypb.Type_INT16:     "SMALLINT",
+	querypb.Type_UINT16:    "SMALLINT UNSIGNED",
+	querypb.Type_INT24:     "MEDIUMINT",
+	querypb.Type_UINT24:    "MEDIUMINT UNSIGNED",
+	querypb.Type_INT32:     "INT",
+	querypb.Type_UINT32:    "INT UNSIGNED",
+	querypb.Type_INT64:     "BIGINT",
+	querypb.Type_UINT64:    "BIGINT UNSIGNED",
+	querypb.Type_FLOAT32:   "FLOAT",
+	querypb.Type_FLOAT64:   "DOUBLE",
+	querypb.Type_TIMESTAMP: "TIMESTAMP",
+	querypb.Type_DATE:      "DATE",
+	querypb.Type_TIME:      "TIME",
+	querypb.Type_DATETIME:  "DATETIME",
+	querypb.Type_YEAR:      "YEAR",
+	querypb.Type_DECIMAL:   "DECIMAL",
+	querypb.Type_TEXT:      "TEXT",
+	querypb.Type_BLOB:      "BLOB",
+	querypb.Type_VARCHAR:   "VARCHAR",
+	querypb.Type_VARBINARY: "VARBINARY",
+	querypb.Type_CHAR:      "CHAR",
+	querypb.Type_BINARY:    "BINARY",
+	querypb.Type_BIT:       "BIT",
+	querypb.Type_ENUM:      "ENUM",
+	querypb.Type_SET:       "SET",
+	querypb.Type_GEOMETRY:  "GEOMETRY",
+	querypb.Type_JSON:      "JSON",
+	querypb.Type_VECTOR:    "VECTOR",
+}
+
+func (r *rows) Close() error {
+	return r.stream.Close()
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	for !r.cur.Next() {
+		if err := r.cur.Err(); err != nil {
+			return err
+		}
+		if err := r.receive(); err != nil {
+			return err
+		}
+	}
+
+	row := r.cur.Row()
+	for i := range dest {
+		v, err := row.Value(i)
+		if err != nil {
+			return err
+		}
+		dest[i] = driverValue(v, row.Raw(i))
+	}
+	return nil
+}
+
+// driverValue narrows a decoded value to the types allowed in a
+// driver.Value, falling back to its text encoding.
+func driverValue(v any, raw []byte) driver.Value {
+	switch v := v.(type) {
+	case nil, int64, float64, string, []byte, time.Time:
+		return v
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return strconv.FormatUint(v, 10)
+	case json.RawMessage:
+		return []byte(v)
+	}
+	return raw
+}
@@ -0,0 +1,23 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// tx is the open transaction tracked by the vitess Session of conn.
+type tx struct {
+	conn *conn
+}
+
+var _ driver.Tx = (*tx)(nil)
+
+func (t *tx) Commit() error {
+	_, err := t.conn.exec(context.Background(), "commit", nil)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	_, err := t.conn.exec(context.Background(), "rollback", nil)
+	return err
+}